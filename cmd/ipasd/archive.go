@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cfg := &storageConfig{}
+	cfg.register(fs)
+	format := fs.String("format", "", "archive format, tar or zip, default from file extension or tar")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: ipasd export [options] [file]
+Export metadata, packages and icons to archive file, write to stdout if file not set.
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	name := fs.Arg(0)
+	f, err := archiveFormat(*format, name)
+	if err != nil {
+		return err
+	}
+	srv, err := newArchiveService(cfg)
+	if err != nil {
+		return err
+	}
+
+	var w io.WriteCloser = os.Stdout
+	if name != "" {
+		w, err = os.Create(name)
+		if err != nil {
+			return err
+		}
+	}
+	defer w.Close()
+	return srv.Export(w, f)
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	cfg := &storageConfig{}
+	cfg.register(fs)
+	format := fs.String("format", "", "archive format, tar or zip, default from file extension or tar")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: ipasd import [options] <file>
+Import archive created by export, apps already exist are skipped, use - to read from stdin.
+NOTE: restart running server to reload metadata, or use /api/import instead.
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	name := fs.Arg(0)
+	if name == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := archiveFormat(*format, name)
+	if err != nil {
+		return err
+	}
+	srv, err := newArchiveService(cfg)
+	if err != nil {
+		return err
+	}
+
+	var r io.ReadCloser = os.Stdin
+	if name != "-" {
+		r, err = os.Open(name)
+		if err != nil {
+			return err
+		}
+	}
+	defer r.Close()
+	result, err := srv.Import(r, f)
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+// format from flag or file extension
+func archiveFormat(format, name string) (service.ArchiveFormat, error) {
+	if format == "" {
+		format = filepath.Ext(name)
+	}
+	if format == "" {
+		return service.ArchiveFormatTar, nil
+	}
+	return service.ParseArchiveFormat(format)
+}
+
+func newArchiveService(cfg *storageConfig) (service.Service, error) {
+	store, err := cfg.newStorager(newLogger())
+	if err != nil {
+		return nil, err
+	}
+	return service.New(store, "", cfg.metaPath, service.WithSnapshotRetention(defaultSnapshotKeep)), nil
+}
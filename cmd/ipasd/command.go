@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// sub command of ipasd, run as: ipasd <command> [options] [args]
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]*command{
+	"snapshot": {
+		usage: "list, diff or restore metadata snapshots",
+		run:   runSnapshot,
+	},
+	"migrate": {
+		usage: "copy packages, icons and metadata between storagers",
+		run:   runMigrate,
+	},
+	"export": {
+		usage: "export metadata, packages and icons to tar or zip archive",
+		run:   runExport,
+	},
+	"import": {
+		usage: "import archive created by export, merge apps by ID",
+		run:   runImport,
+	},
+	"reconcile": {
+		usage: "report or delete orphaned files, stale temp files and apps whose package missing",
+		run:   runReconcile,
+	},
+	"rekey": {
+		usage: "rewrap data keys of encrypted files with new key",
+		run:   runRekey,
+	},
+}
+
+func newLogger() log.Logger {
+	logger := log.NewLogfmtLogger(os.Stderr)
+	return log.With(logger, "ts", log.TimestampFormat(time.Now, "2006-01-02 15:04:05.000"), "caller", log.DefaultCaller)
+}
+
+// print command result to stdout
+func printJSON(v interface{}) error {
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+func commandsUsage() {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n    \t%s\n", name, commands[name].usage)
+	}
+}
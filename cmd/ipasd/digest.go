@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+)
+
+// set ETag and Content-Digest of packages served by server, prefix is trimmed from path to get storage name
+func digest(srv service.Service, prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), strings.TrimSuffix(prefix, "/"))
+		app, err := srv.FindByStorageName(name)
+		if err == nil && app.SHA256 != "" {
+			etag := fmt.Sprintf(`"%s"`, app.SHA256)
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			// digest of full content, not match partial content
+			if b, err := hex.DecodeString(app.SHA256); err == nil && r.Header.Get("Range") == "" {
+				w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(b)+":")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hash stored packages every interval, flag packages checksum not match
+func runVerifyJob(srv service.Service, interval time.Duration, logger log.Logger) {
+	for {
+		time.Sleep(interval)
+		result, err := srv.Verify()
+		if err != nil {
+			logger.Log("msg", fmt.Sprintf("verify packages err: %v", err))
+			continue
+		}
+		for _, id := range result.Corrupted {
+			logger.Log("msg", fmt.Sprintf("package of app %s corrupted", id))
+		}
+		for _, id := range result.Missing {
+			logger.Log("msg", fmt.Sprintf("package of app %s missing", id))
+		}
+		logger.Log("msg", fmt.Sprintf("verified %d packages, %d corrupted, %d missing", result.Checked, len(result.Corrupted), len(result.Missing)))
+	}
+}
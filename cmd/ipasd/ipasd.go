@@ -1,14 +1,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 	"time"
 
-	"github.com/go-kit/kit/log"
 	"github.com/spf13/afero"
 
 	httptransport "github.com/go-kit/kit/transport/http"
@@ -32,20 +33,79 @@ func redirect(m map[string]string, next http.Handler) http.Handler {
 	})
 }
 
+// route requests by method, other methods to next
+func methods(m map[string]http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := m[r.Method]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hide private dirs from static file server
+func hide(dirs []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := path.Clean("/" + r.URL.Path)
+		for _, d := range dirs {
+			if p == "/"+d || strings.HasPrefix(p, "/"+d+"/") {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+const (
+	defaultSnapshotKeep     = 10
+	defaultRepairInterval   = time.Hour
+	defaultPruneInterval    = time.Hour
+	defaultTrashDays        = 30
+	purgeInterval           = time.Hour
+	defaultScheduleInterval = time.Minute
+)
+
 func main() {
 
+	// sub commands
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "err: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	addr := flag.String("addr", "0.0.0.0", "bind addr")
 	port := flag.String("port", "8080", "bind port")
 	debug := flag.Bool("d", false, "enable debug logging")
 	user := flag.String("user", "", "basic auth username")
 	pass := flag.String("pass", "", "basic auth password")
-	storageDir := flag.String("dir", "upload", "upload data storage dir")
 	publicURL := flag.String("public-url", "", "server public url")
-	metadataPath := flag.String("meta-path", "appList.json", "metadata storage path, use random secret path to keep your metadata safer")
 	deleteEnabled := flag.Bool("del", false, "delete app enabled")
 	uploadDisabled := flag.Bool("upload-disabled", false, "upload app enabled")
-	remoteCfg := flag.String("remote", "", "remote storager config, s3://ENDPOINT:AK:SK:BUCKET, alioss://ENDPOINT:AK:SK:BUCKET, qiniu://[ZONE]:AK:SK:BUCKET")
-	remoteURL := flag.String("remote-url", "", "remote storager public url, https://cdn.example.com")
+	archiveEnabled := flag.Bool("archive", false, "export and import API enabled, export includes all builds, import adds builds")
+	reconcileFix := flag.Bool("reconcile-fix", false, "reconcile API deletes orphans and removes missing apps by POST, requires -user")
+	snapshotKeep := flag.Int("snapshot-keep", defaultSnapshotKeep, "metadata snapshots to keep, 0 to disable snapshots")
+	dedup := flag.String("dedup", string(service.DedupOff), "package uploaded again with same identifier and sha256, off: save as new app, existing: return existing app, alias: add new app share files of existing app")
+	duplicate := flag.String("duplicate", string(service.DuplicateAllow), "package uploaded with same identifier, version, build, channel and type of existing app, allow: save as new app, reject: refuse with 409, replace: replace existing app and keep its id")
+	strictVersionCode := flag.Bool("strict-version-code", false, "refuse apk with versionCode lower than the latest apk of identifier")
+	order := flag.String("order", string(service.OrderDate), "order of builds to pick the current and latest build, date: newest upload first, version: highest version then build number first")
+	verifyInterval := flag.Duration("verify-interval", 0, "interval to hash stored packages again and flag corrupted packages, 0 to disable")
+	repairInterval := flag.Duration("repair-interval", defaultRepairInterval, "interval to copy files missing from mirror storagers, 0 to disable")
+	trashDays := flag.Int("trash-days", defaultTrashDays, "days to keep deleted apps in trash before purged, 0 to keep forever")
+	retention := stringsFlag{}
+	flag.Var(&retention, "retention", "retention rule, identifier=GLOB&channel=GLOB&keep=N&days=D, keep last N builds of each identifier and channel and delete builds older than D days, first matched rule used, can be set multiple times")
+	retentionBudget := flag.String("retention-budget", "", "total size of packages, oldest builds deleted first when exceeded, eg: 20G")
+	pruneInterval := flag.Duration("prune-interval", defaultPruneInterval, "interval to delete builds not kept by -retention and -retention-budget, 0 to disable")
+	scheduleInterval := flag.Duration("schedule-interval", defaultScheduleInterval, "interval to check apps published or expired and send notifications, 0 to disable")
+	notifyURL := flag.String("notify-url", "", "webhook url, events of apps published or expired are POST to it as JSON")
+	storageCfg := &storageConfig{}
+	storageCfg.register(flag.CommandLine)
 	realm := "My Realm"
 
 	flag.Usage = usage
@@ -53,52 +113,80 @@ func main() {
 
 	serve := http.NewServeMux()
 
-	logger := log.NewLogfmtLogger(os.Stderr)
-	logger = log.With(logger, "ts", log.TimestampFormat(time.Now, "2006-01-02 15:04:05.000"), "caller", log.DefaultCaller)
-
-	var store storager.Storager
-	if *remoteCfg != "" && *remoteURL != "" {
-		r := strings.Split(*remoteCfg, "://")
-		if len(r) != 2 {
-			usage()
-			os.Exit(0)
-		}
-		args := strings.Split(r[1], ":")
-		if len(args) != 4 {
-			usage()
-			os.Exit(0)
-		}
+	logger := newLogger()
 
-		switch r[0] {
-		case "s3":
-			logger.Log("msg", "used s3 storager")
-			s, err := storager.NewS3Storager(args[0], args[1], args[2], args[3], *remoteURL)
-			if err != nil {
-				panic(err)
-			}
-			store = s
-		case "alioss":
-			logger.Log("msg", "used alioss storager")
-			s, err := storager.NewAliOssStorager(args[0], args[1], args[2], args[3], *remoteURL)
-			if err != nil {
-				panic(err)
-			}
-			store = s
-		case "qiniu":
-			logger.Log("msg", "used qiniu storager")
-			s, err := storager.NewQiniuStorager(args[0], args[1], args[2], args[3], *remoteURL)
-			if err != nil {
-				panic(err)
-			}
-			store = s
-		}
-	} else {
-		logger.Log("msg", "used os file storager")
-		store = storager.NewOsFileStorager(*storageDir)
+	store, err := storageCfg.newStorager(logger)
+	if errors.Is(err, storager.ErrDSNInvalid) || errors.Is(err, storager.ErrDSNSchemeInvalid) {
+		logger.Log("msg", fmt.Sprintf("err: %v", err))
+		usage()
+		os.Exit(0)
+	}
+	if err != nil {
+		panic(err)
+	}
+	dedupPolicy, err := service.ParseDedupPolicy(*dedup)
+	if err != nil {
+		logger.Log("msg", fmt.Sprintf("err: %v", err))
+		usage()
+		os.Exit(0)
+	}
+	duplicatePolicy, err := service.ParseDuplicatePolicy(*duplicate)
+	if err != nil {
+		logger.Log("msg", fmt.Sprintf("err: %v", err))
+		usage()
+		os.Exit(0)
+	}
+	ordering, err := service.ParseOrdering(*order)
+	if err != nil {
+		logger.Log("msg", fmt.Sprintf("err: %v", err))
+		usage()
+		os.Exit(0)
+	}
+	policy, err := newRetentionPolicy(retention, *retentionBudget)
+	if err != nil {
+		logger.Log("msg", fmt.Sprintf("err: %v", err))
+		usage()
+		os.Exit(0)
+	}
+	srv := service.New(
+		store,
+		*publicURL,
+		storageCfg.metaPath,
+		service.WithSnapshotRetention(*snapshotKeep),
+		service.WithDedupPolicy(dedupPolicy),
+		service.WithDuplicatePolicy(duplicatePolicy),
+		service.WithStrictVersionCode(*strictVersionCode),
+		service.WithOrdering(ordering),
+		service.WithRetentionPolicy(policy),
+		service.WithTrashRetention(time.Duration(*trashDays)*24*time.Hour),
+	)
+	names, base := srv.StorageNames, store
+	if e, ok := store.(*storager.EncryptStorager); ok {
+		// mirrors saved encrypted files and wrapped data keys
+		names = func() []string { return e.WithKeyNames(srv.StorageNames()) }
+		base = e.Unwrap()
+	}
+	if m, ok := base.(*storager.MirrorStorager); ok && *repairInterval > 0 {
+		go runRepairJob(m, names, *repairInterval, logger)
+	}
+	if *verifyInterval > 0 {
+		go runVerifyJob(srv, *verifyInterval, logger)
+	}
+	if policy.Enabled() && *pruneInterval > 0 {
+		go runPruneJob(srv, *pruneInterval, logger)
+	}
+	if *trashDays > 0 {
+		go runPurgeJob(srv, purgeInterval, logger)
+	}
+	if *scheduleInterval > 0 {
+		go runScheduleJob(srv, *scheduleInterval, *notifyURL, logger)
+	}
+	if *reconcileFix && *user == "" {
+		logger.Log("msg", "-reconcile-fix ignored without -user")
 	}
-
-	srv := service.New(store, *publicURL, *metadataPath)
 	basicAuth := service.BasicAuthMiddleware(*user, *pass, realm)
+	// refused if -user not set
+	requireAuth := service.AuthRequiredMiddleware(*user, *pass, realm)
 	listHandler := httptransport.NewServer(
 		basicAuth(service.LoggingMiddleware(logger, "/api/list", *debug)(service.MakeListEndpoint(srv, !*uploadDisabled))),
 		service.DecodeListRequest,
@@ -110,6 +198,12 @@ func main() {
 		service.DecodeFindRequest,
 		service.EncodeJsonResponse,
 	)
+	editHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/info/edit", *debug)(service.MakeEditEndpoint(srv))),
+		service.DecodeEditRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
 	addHandler := httptransport.NewServer(
 		basicAuth(service.LoggingMiddleware(logger, "/api/upload", *debug)(service.MakeAddEndpoint(srv, !*uploadDisabled))),
 		service.DecodeAddRequest,
@@ -128,6 +222,112 @@ func main() {
 		service.EncodeJsonResponse,
 		httptransport.ServerBefore(httptransport.PopulateRequestContext),
 	)
+	snapshotListHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/snapshot/list", *debug)(service.MakeSnapshotListEndpoint(srv))),
+		service.DecodeSnapshotListRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	snapshotDiffHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/snapshot/diff", *debug)(service.MakeSnapshotDiffEndpoint(srv))),
+		service.DecodeSnapshotDiffRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	snapshotRestoreHandler := httptransport.NewServer(
+		requireAuth(service.LoggingMiddleware(logger, "/api/snapshot/restore", *debug)(service.MakeSnapshotRestoreEndpoint(srv))),
+		service.DecodeSnapshotRestoreRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	exportHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/export", *debug)(service.MakeExportEndpoint(srv, *archiveEnabled))),
+		service.DecodeExportRequest,
+		service.EncodeArchiveResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	importHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/import", *debug)(service.MakeImportEndpoint(srv, *archiveEnabled))),
+		service.DecodeImportRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	scheduledHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/scheduled", *debug)(service.MakeScheduledEndpoint(srv))),
+		service.DecodeScheduledRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	trashHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/trash", *debug)(service.MakeTrashEndpoint(srv))),
+		service.DecodeTrashRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	restoreHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/trash/restore", *debug)(service.MakeRestoreEndpoint(srv))),
+		service.DecodeTrashItemRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	purgeHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/trash/purge", *debug)(service.MakePurgeEndpoint(srv, *deleteEnabled))),
+		service.DecodeTrashItemRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	batchHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/batch", *debug)(service.MakeBatchEndpoint(srv, *deleteEnabled, *user != ""))),
+		service.DecodeBatchRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	pinHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/pin", *debug)(service.MakePinEndpoint(srv))),
+		service.DecodePinRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	lockHandler := httptransport.NewServer(
+		requireAuth(service.LoggingMiddleware(logger, "/api/lock", *debug)(service.MakeLockEndpoint(srv))),
+		service.DecodeLockRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	pruneHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/retention", *debug)(service.MakePruneEndpoint(srv, *user != ""))),
+		service.DecodePruneRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	reconcileHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/reconcile", *debug)(service.MakeReconcileEndpoint(srv, *reconcileFix && *user != ""))),
+		service.DecodeReconcileRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	promoteHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/promote", *debug)(service.MakePromoteEndpoint(srv))),
+		service.DecodePromoteRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	tracksHandler := httptransport.NewServer(
+		basicAuth(service.LoggingMiddleware(logger, "/api/tracks", *debug)(service.MakeTracksEndpoint(srv))),
+		service.DecodeTracksRequest,
+		service.EncodeJsonResponse,
+		httptransport.ServerBefore(httptransport.PopulateRequestContext),
+	)
+	trackURLHandler := httptransport.NewServer(
+		service.LoggingMiddleware(logger, "/apps", *debug)(service.MakeTrackURLEndpoint(srv)),
+		service.DecodeTrackURLRequest,
+		service.EncodeResolveResponse,
+	)
+	latestHandler := httptransport.NewServer(
+		service.LoggingMiddleware(logger, "/latest", *debug)(service.MakeLatestEndpoint(srv)),
+		service.DecodeLatestRequest,
+		service.EncodeResolveResponse,
+	)
 	plistHandler := httptransport.NewServer(
 		service.LoggingMiddleware(logger, "/plist", *debug)(service.MakePlistEndpoint(srv)),
 		service.DecodePlistRequest,
@@ -136,11 +336,37 @@ func main() {
 
 	// parser API
 	serve.Handle("/api/list", listHandler)
-	serve.Handle("/api/info/", findHandler)
+	serve.Handle("/api/info/", methods(map[string]http.Handler{http.MethodPatch: editHandler}, findHandler))
 	serve.Handle("/api/upload", addHandler)
 	serve.Handle("/api/delete", deleteHandler)
 	serve.Handle("/api/delete/get", deleteGetHandler)
+	serve.Handle("/api/scheduled", scheduledHandler)
+	serve.Handle("/api/trash", trashHandler)
+	serve.Handle("/api/trash/restore", restoreHandler)
+	serve.Handle("/api/trash/purge", purgeHandler)
+	serve.Handle("/api/batch", batchHandler)
+	serve.Handle("/api/pin", pinHandler)
+	serve.Handle("/api/lock", lockHandler)
+	serve.Handle("/api/promote", promoteHandler)
+	serve.Handle("/api/tracks/", tracksHandler)
 	serve.Handle("/plist/", plistHandler)
+	// stable urls of builds promoted to tracks
+	serve.Handle("/apps/", trackURLHandler)
+	// stable urls of newest builds
+	serve.Handle("/latest/", latestHandler)
+	// admin API
+	serve.Handle("/api/snapshot/list", snapshotListHandler)
+	serve.Handle("/api/snapshot/diff/", snapshotDiffHandler)
+	serve.Handle("/api/snapshot/restore", snapshotRestoreHandler)
+	serve.Handle("/api/export", exportHandler)
+	serve.Handle("/api/import", importHandler)
+	serve.Handle("/api/reconcile", reconcileHandler)
+	serve.Handle("/api/retention", pruneHandler)
+	// download files from storager which can not be accessed by public,
+	// not mounted for storagers with public or signed url to keep private bucket private
+	if storager.UseProxy(store) {
+		serve.Handle(storager.ProxyPath, visible(srv, storager.ProxyPath, digest(srv, storager.ProxyPath, storagerProxy(store, append(service.PrivateDirs(), storager.EncryptKeyDir, storageCfg.metaPath)))))
+	}
 	// upload file over Websocket
 	serve.Handle("/api/upload/ws", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -163,6 +389,7 @@ func main() {
 			logger.Log("msg", fmt.Sprintf("err: %v", err))
 			return
 		}
+		defer f.Close()
 
 		size, err := f.Size()
 		if err != nil {
@@ -179,11 +406,27 @@ func main() {
 
 		logger.Log("name:", name, " size:", size)
 
-		info, err := srv.Add(f, size, t)
+		// notes, publishAt and expireAt sent with name
+		opts, err := service.ParseAddOptions(f.Param)
 		if err != nil {
 			logger.Log("msg", fmt.Sprintf("err: %v", err))
 			return
 		}
+		info, err := srv.Add(f, size, t, opts)
+		if err != nil {
+			logger.Log("msg", fmt.Sprintf("err: %v", err))
+			// send error before closing, conflict with status 409 and id of existing app
+			resp := map[string]interface{}{"err": err.Error(), "status": http.StatusInternalServerError}
+			var conflict *service.ConflictError
+			if errors.As(err, &conflict) {
+				resp["status"] = conflict.StatusCode()
+				resp["id"] = conflict.ID
+			}
+			if err := f.Done(resp); err != nil {
+				logger.Log("msg", fmt.Sprintf("err: %v", err))
+			}
+			return
+		}
 
 		err = f.Done(common.ToMap(info))
 		if err != nil {
@@ -194,15 +437,20 @@ func main() {
 	}))
 
 	// static files
-	uploadFS := afero.NewBasePathFs(afero.NewOsFs(), *storageDir)
+	uploadFS := afero.NewBasePathFs(afero.NewOsFs(), storageCfg.dir)
 	staticFS := httpfs.New(
 		http.FS(public.FS),
 		httpfs.NewAferoFS(uploadFS),
 	)
+	static := http.FileServer(staticFS)
+	if _, ok := store.(*storager.EncryptStorager); !ok {
+		// files on disk are ciphertext if encrypted, digest of plaintext only set by proxy
+		static = digest(srv, "/", static)
+	}
 	serve.Handle("/", redirect(map[string]string{
 		// random path to block local metadata
-		fmt.Sprintf("/%s", *metadataPath): fmt.Sprintf("/%s", uuid.NewString()),
-	}, http.FileServer(staticFS)))
+		fmt.Sprintf("/%s", storageCfg.metaPath): fmt.Sprintf("/%s", uuid.NewString()),
+	}, hide(append(service.PrivateDirs(), storager.EncryptKeyDir), visible(srv, "/", static))))
 
 	host := fmt.Sprintf("%s:%s", *addr, *port)
 	logger.Log("msg", fmt.Sprintf("SERVER LISTEN ON: http://%v", host))
@@ -210,8 +458,10 @@ func main() {
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, `Usage: ipa-server [options]
+	fmt.Fprintf(os.Stderr, `Usage: ipasd [options]
+       ipasd <command> [options] [args]
 Options:
 `)
 	flag.PrintDefaults()
+	commandsUsage()
 }
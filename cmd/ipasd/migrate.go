@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+var (
+	ErrMigrateStoragerRequired = errors.New("-from and -to are required")
+)
+
+// migrate progress, saved after each file copied to resume after interruption
+type migrateState struct {
+	// sha256 of source and target DSN, DSN not saved since it may contain secrets
+	From string `json:"from"`
+	To   string `json:"to"`
+	// copied and verified files
+	Done map[string]*storager.Checksum `json:"done"`
+}
+
+type migrateResult struct {
+	Copied  int `json:"copied"`
+	Skipped int `json:"skipped"`
+	// files referenced by metadata but not found in source storager
+	Missing []string `json:"missing"`
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "source storager DSN, file:///path/to/upload for local dir")
+	fromURL := fs.String("from-url", "", "source storager public url, required by qiniu")
+	to := fs.String("to", "", "target storager DSN")
+	toURL := fs.String("to-url", "", "target storager public url, required by qiniu")
+	metaPath := fs.String("meta-path", "appList.json", "metadata storage path")
+	encryptionKey := fs.String("encryption-key", "", "key file of encrypted storagers, files are decrypted from source and encrypted again to target")
+	statePath := fs.String("state", "ipasd-migrate.json", "local file to save progress, rerun with same file to resume")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: ipasd migrate -from <dsn> -to <dsn> [options]
+Copy packages, icons and metadata referenced by metadata from one storager to another, metadata is copied last.
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *from == "" || *to == "" {
+		fs.Usage()
+		return ErrMigrateStoragerRequired
+	}
+
+	src, err := storager.Open(*from, *fromURL)
+	if err != nil {
+		return err
+	}
+	dest, err := storager.Open(*to, *toURL)
+	if err != nil {
+		return err
+	}
+
+	if *encryptionKey != "" {
+		keys, err := storager.LoadKeyring(*encryptionKey)
+		if err != nil {
+			return err
+		}
+		src = storager.NewEncryptStorager(src, keys)
+		dest = storager.NewEncryptStorager(dest, keys)
+	}
+
+	state, err := loadMigrateState(*statePath, *from, *to)
+	if err != nil {
+		return err
+	}
+
+	logger := newLogger()
+	// load metadata from source without writing snapshots
+	srv := service.New(src, "", *metaPath, service.WithSnapshotRetention(0))
+	result := &migrateResult{Missing: []string{}}
+	for _, name := range srv.StorageNames() {
+		if name == *metaPath {
+			continue
+		}
+		if _, ok := state.Done[name]; ok {
+			result.Skipped++
+			continue
+		}
+		sum, err := storager.Copy(src, dest, name)
+		if err != nil {
+			r, openErr := src.OpenMetadata(name)
+			if openErr != nil {
+				logger.Log("msg", fmt.Sprintf("skip missing file %s: %v", name, openErr))
+				result.Missing = append(result.Missing, name)
+				continue
+			}
+			r.Close()
+			return err
+		}
+		logger.Log("msg", fmt.Sprintf("copied %s %d bytes", name, sum.Size))
+		state.Done[name] = sum
+		result.Copied++
+		if err := state.save(*statePath); err != nil {
+			return err
+		}
+	}
+
+	// copy metadata last, target is usable only after all files copied
+	sum, err := storager.Copy(src, dest, *metaPath)
+	if err != nil {
+		return err
+	}
+	state.Done[*metaPath] = sum
+	result.Copied++
+	if err := state.save(*statePath); err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+func dsnHash(dsn string) string {
+	sum := sha256.Sum256([]byte(dsn))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadMigrateState(name, from, to string) (*migrateState, error) {
+	from, to = dsnHash(from), dsnHash(to)
+	state := &migrateState{From: from, To: to, Done: map[string]*storager.Checksum{}}
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	old := &migrateState{}
+	if err := json.Unmarshal(b, old); err != nil {
+		return nil, err
+	}
+	// progress of other migration
+	if old.From != from || old.To != to || old.Done == nil {
+		return state, nil
+	}
+	// metadata always copied again
+	return old, nil
+}
+
+func (m *migrateState) save(name string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to temp file and rename to avoid broken state
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	// temp file left by interrupted run keeps its mode
+	if err := os.Chmod(tmp, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+// download files from storager over server, for storager can not be accessed by public
+func storagerProxy(store storager.Storager, hidden []string) http.Handler {
+	prefix := strings.TrimSuffix(storager.ProxyPath, "/")
+	return http.StripPrefix(prefix, hide(hidden, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		f, err := store.OpenMetadata(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+
+		t := mime.TypeByExtension(path.Ext(name))
+		if t == "" {
+			t = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", t)
+		_, _ = io.Copy(w, f)
+	})))
+}
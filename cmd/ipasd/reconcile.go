@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+)
+
+func runReconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	cfg := &storageConfig{}
+	cfg.register(fs)
+	fix := fs.Bool("fix", false, "delete orphans and stale temp files, remove apps whose package missing from metadata")
+	tempAge := fs.Duration("temp-age", service.DefaultTempAge, "temp files older than it are stale")
+	keep := fs.Int("snapshot-keep", defaultSnapshotKeep, "metadata snapshots to keep")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: ipasd reconcile [options]
+Compare files in storage with metadata, report only unless -fix set.
+NOTE: files uploaded by running server after metadata loaded are reported as orphans, use /api/reconcile instead.
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	store, err := cfg.newStorager(newLogger())
+	if err != nil {
+		return err
+	}
+	srv := service.New(store, "", cfg.metaPath, service.WithSnapshotRetention(*keep))
+	result, err := srv.Reconcile(*fix, *tempAge)
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+var (
+	ErrEncryptionKeyRequired = errors.New("-encryption-key is required")
+)
+
+type rekeyResult struct {
+	Rewrapped int `json:"rewrapped"`
+	// not encrypted or already use current key
+	Skipped int `json:"skipped"`
+	// files referenced by metadata but not found
+	Missing []string `json:"missing"`
+}
+
+func runRekey(args []string) error {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	cfg := &storageConfig{}
+	cfg.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: ipasd rekey -encryption-key <file> [options]
+Rewrap data keys of encrypted files with first key of key file, file headers are rewritten and data is not encrypted again.
+Put new key at the first line of key file and keep old keys, remove old keys after rekey finished.
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if cfg.encryptionKey == "" {
+		fs.Usage()
+		return ErrEncryptionKeyRequired
+	}
+
+	logger := newLogger()
+	store, err := cfg.newStorager(logger)
+	if err != nil {
+		return err
+	}
+	e, ok := store.(*storager.EncryptStorager)
+	if !ok {
+		return ErrEncryptionKeyRequired
+	}
+
+	srv := service.New(store, "", cfg.metaPath, service.WithSnapshotRetention(0))
+	result := &rekeyResult{Missing: []string{}}
+	for _, name := range srv.StorageNames() {
+		ok, err := e.Rewrap(name)
+		if err != nil {
+			r, openErr := store.OpenMetadata(name)
+			if openErr != nil {
+				logger.Log("msg", fmt.Sprintf("skip missing file %s: %v", name, openErr))
+				result.Missing = append(result.Missing, name)
+				continue
+			}
+			r.Close()
+			return err
+		}
+		if ok {
+			result.Rewrapped++
+		} else {
+			result.Skipped++
+		}
+	}
+	return printJSON(result)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+// copy files missing from mirror tiers every interval
+func runRepairJob(m *storager.MirrorStorager, names func() []string, interval time.Duration, logger log.Logger) {
+	for {
+		time.Sleep(interval)
+		repaired, err := m.Repair(names())
+		if err != nil {
+			logger.Log("msg", fmt.Sprintf("repair mirrors err: %v", err))
+		}
+		if repaired > 0 {
+			logger.Log("msg", fmt.Sprintf("repaired %d files of mirrors", repaired))
+		}
+	}
+}
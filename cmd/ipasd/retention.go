@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+// policy of -retention rules and -retention-budget
+func newRetentionPolicy(rules []string, budget string) (*service.RetentionPolicy, error) {
+	p := &service.RetentionPolicy{Rules: []*service.RetentionRule{}}
+	for _, s := range rules {
+		r, err := service.ParseRetentionRule(s)
+		if err != nil {
+			return nil, err
+		}
+		p.Rules = append(p.Rules, r)
+	}
+	if budget != "" {
+		n, err := storager.ParseSize(budget)
+		if err != nil {
+			return nil, fmt.Errorf("-retention-budget invalid: %w", err)
+		}
+		p.Budget = n
+	}
+	return p, nil
+}
+
+// delete builds not kept by retention policy every interval
+func runPruneJob(srv service.Service, interval time.Duration, logger log.Logger) {
+	for {
+		time.Sleep(interval)
+		result, err := srv.Prune(false)
+		if err != nil {
+			logger.Log("msg", fmt.Sprintf("prune builds err: %v", err))
+		}
+		if result == nil {
+			continue
+		}
+		for _, app := range result.Pruned {
+			logger.Log("msg", fmt.Sprintf("pruned %s %s(%s) of %s, reason: %s", app.Identifier, app.Version, app.Build, app.ID, app.Reason))
+		}
+		if len(result.Pruned) > 0 {
+			logger.Log("msg", fmt.Sprintf("pruned %d builds, freed %d bytes", len(result.Pruned), result.FreedSize))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+)
+
+// hide packages of apps not published yet or expired, prefix is trimmed from path to get storage name
+func visible(srv service.Service, prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), strings.TrimSuffix(prefix, "/"))
+		if !srv.PackageVisible(name) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// send events of apps published or expired every interval, POST each event as JSON to notifyURL if set.
+// events are marked notified after delivered, failed events are sent again next interval
+func runScheduleJob(srv service.Service, interval time.Duration, notifyURL string, logger log.Logger) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for {
+		time.Sleep(interval)
+		events, err := srv.Schedule()
+		if err != nil {
+			logger.Log("msg", fmt.Sprintf("schedule err: %v", err))
+		}
+		for _, e := range events {
+			if notifyURL != "" {
+				if err := notify(client, notifyURL, e); err != nil {
+					logger.Log("msg", fmt.Sprintf("notify %s of %s err: %v, retry next interval", e.Event, e.ID, err))
+					continue
+				}
+			}
+			logger.Log("msg", fmt.Sprintf("%s %s %s(%s) of %s", e.Event, e.Identifier, e.Version, e.Build, e.ID))
+			if err := srv.MarkNotified(e.ID, e.Event); err != nil {
+				logger.Log("msg", fmt.Sprintf("mark %s of %s notified err: %v", e.Event, e.ID, err))
+			}
+		}
+	}
+}
+
+func notify(client *http.Client, url string, e *service.ScheduleEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -27,6 +27,34 @@ type AppInfo struct {
 	MetaData map[string]interface{} `json:"metaData"`
 	// store name
 	StorageName string `json:"storageName"`
+	// icon store name, set when icon shared with other app
+	IconName string `json:"iconName,omitempty"`
+	// hex sha256 and sha1 of package
+	SHA256 string `json:"sha256,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+	// package checksum not match, flagged by verify
+	Corrupted bool `json:"corrupted,omitempty"`
+	// exempt from retention pruning, listed at the top of history
+	Pinned bool `json:"pinned,omitempty"`
+	// can not be deleted or pruned
+	Locked bool `json:"locked,omitempty"`
+	// labels set by batch tag action
+	Tags []string `json:"tags,omitempty"`
+	// moved to trash at, files are kept until purged
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// name edited by user, shown instead of Name if set
+	DisplayName string `json:"displayName,omitempty"`
+	// release notes in Markdown
+	Notes string `json:"notes,omitempty"`
+	// tracks build promoted to, one build of each identifier for each track
+	Tracks []string `json:"tracks,omitempty"`
+	// promotions of build, kept after build replaced on track
+	Promotions []*Promotion `json:"promotions,omitempty"`
+	// hidden before PublishAt and since ExpireAt, nil for no limit
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	ExpireAt  *time.Time `json:"expireAt,omitempty"`
+	// schedule events sent: published, expired
+	Notified []string `json:"notified,omitempty"`
 }
 
 const (
@@ -101,6 +129,9 @@ func (a *AppInfo) IconStorageName() string {
 	if a.NoneIcon {
 		return ""
 	}
+	if a.IconName != "" {
+		return a.IconName
+	}
 	return filepath.Join(a.Identifier, a.ID+".png")
 }
 
@@ -110,3 +141,17 @@ func (a *AppInfo) PackageStorageName() string {
 	}
 	return filepath.Join(a.Identifier, a.ID+a.Type.StorageName())
 }
+
+// Trashed app deleted but not purged
+func (a *AppInfo) Trashed() bool {
+	return a.DeletedAt != nil
+}
+
+// StorageNames names of all files belong to app
+func (a *AppInfo) StorageNames() []string {
+	names := []string{a.PackageStorageName()}
+	if !a.NoneIcon {
+		names = append(names, a.IconStorageName())
+	}
+	return names
+}
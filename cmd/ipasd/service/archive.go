@@ -0,0 +1,506 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+	"github.com/iineva/ipa-server/pkg/uuid"
+)
+
+type ArchiveFormat string
+
+const (
+	ArchiveFormatTar = ArchiveFormat("tar")
+	ArchiveFormatZip = ArchiveFormat("zip")
+
+	archiveVersion      = 1
+	archiveMetadataName = "metadata.json"
+	archiveManifestName = "manifest.json"
+	archiveFilesDir     = "files"
+)
+
+var (
+	ErrArchiveFormatInvalid = errors.New("archive format invalid, tar or zip only")
+	ErrArchiveInvalid       = errors.New("archive invalid")
+)
+
+// ArchiveManifest last entry of archive, checksums of all other entries
+type ArchiveManifest struct {
+	Version int       `json:"version"`
+	Date    time.Time `json:"date"`
+	Apps    int       `json:"apps"`
+	// archive entry name to checksum
+	Files map[string]*storager.Checksum `json:"files"`
+}
+
+// ImportResult app IDs of import
+type ImportResult struct {
+	Added []string `json:"added"`
+	// already exists
+	Skipped []string `json:"skipped"`
+	// package not found in archive, not imported
+	Missing []string `json:"missing"`
+}
+
+func ParseArchiveFormat(f string) (ArchiveFormat, error) {
+	switch ArchiveFormat(strings.TrimPrefix(strings.ToLower(f), ".")) {
+	case ArchiveFormatTar:
+		return ArchiveFormatTar, nil
+	case ArchiveFormatZip:
+		return ArchiveFormatZip, nil
+	}
+	return "", ErrArchiveFormatInvalid
+}
+
+// archive entry name of storage file
+func archiveFileName(name string) string {
+	return path.Join(archiveFilesDir, filepath.ToSlash(name))
+}
+
+type archiveWriter interface {
+	WriteFile(name string, size int64, r io.Reader) error
+	Close() error
+}
+
+type tarArchiveWriter struct {
+	w *tar.Writer
+}
+
+func (t *tarArchiveWriter) WriteFile(name string, size int64, r io.Reader) error {
+	if err := t.w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.w, r)
+	return err
+}
+
+func (t *tarArchiveWriter) Close() error {
+	return t.w.Close()
+}
+
+type zipArchiveWriter struct {
+	w *zip.Writer
+}
+
+func (z *zipArchiveWriter) WriteFile(name string, _ int64, r io.Reader) error {
+	f, err := z.w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (z *zipArchiveWriter) Close() error {
+	return z.w.Close()
+}
+
+func newArchiveWriter(w io.Writer, format ArchiveFormat) (archiveWriter, error) {
+	switch format {
+	case ArchiveFormatTar:
+		return &tarArchiveWriter{w: tar.NewWriter(w)}, nil
+	case ArchiveFormatZip:
+		return &zipArchiveWriter{w: zip.NewWriter(w)}, nil
+	}
+	return nil, ErrArchiveFormatInvalid
+}
+
+// Export write metadata, packages and icons to archive, entries order: metadata.json, files/..., manifest.json
+func (s *service) Export(w io.Writer, format ArchiveFormat) error {
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	s.lock.RLock()
+	list := append(AppList{}, s.list...)
+	s.lock.RUnlock()
+
+	manifest := &ArchiveManifest{
+		Version: archiveVersion,
+		Date:    time.Now(),
+		Apps:    len(list),
+		Files:   map[string]*storager.Checksum{},
+	}
+
+	d, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if err := writeArchiveFile(aw, manifest, archiveMetadataName, ioutil.NopCloser(bytes.NewReader(d))); err != nil {
+		return err
+	}
+
+	for _, app := range list {
+		for _, name := range app.StorageNames() {
+			if _, ok := manifest.Files[archiveFileName(name)]; ok {
+				// shared by alias apps
+				continue
+			}
+			r, err := s.store.OpenMetadata(name)
+			if err != nil {
+				// NOTE: skip missing file, app without package will not be imported
+				continue
+			}
+			err = writeArchiveFile(aw, manifest, archiveFileName(name), r)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	d, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := aw.WriteFile(archiveManifestName, int64(len(d)), bytes.NewReader(d)); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// spool file to local temp file to get size and checksum before writing to archive
+func writeArchiveFile(aw archiveWriter, manifest *ArchiveManifest, name string, r io.ReadCloser) error {
+	defer r.Close()
+	f, err := ioutil.TempFile("", "ipasd-export-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := aw.WriteFile(name, size, f); err != nil {
+		return err
+	}
+	manifest.Files[name] = &storager.Checksum{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+	return nil
+}
+
+type archiveReader interface {
+	// io.EOF if no more entry
+	Next() (string, io.Reader, error)
+}
+
+type tarArchiveReader struct {
+	r *tar.Reader
+}
+
+func (t *tarArchiveReader) Next() (string, io.Reader, error) {
+	for {
+		h, err := t.r.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if h.Typeflag == tar.TypeReg {
+			return h.Name, t.r, nil
+		}
+	}
+}
+
+type zipArchiveReader struct {
+	files []*zip.File
+	// current entry
+	rc io.ReadCloser
+}
+
+func (z *zipArchiveReader) Next() (string, io.Reader, error) {
+	if z.rc != nil {
+		z.rc.Close()
+		z.rc = nil
+	}
+	for len(z.files) > 0 {
+		f := z.files[0]
+		z.files = z.files[1:]
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		z.rc = rc
+		return f.Name, rc, nil
+	}
+	return "", nil, io.EOF
+}
+
+// Import merge apps of archive by ID, apps already exist are skipped
+func (s *service) Import(r io.Reader, format ArchiveFormat) (*ImportResult, error) {
+	var ar archiveReader
+	switch format {
+	case ArchiveFormatTar:
+		ar = &tarArchiveReader{r: tar.NewReader(r)}
+	case ArchiveFormatZip:
+		// zip need random access, spool to local temp file
+		f, err := ioutil.TempFile("", "ipasd-import-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		size, err := io.Copy(f, r)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return nil, err
+		}
+		ar = &zipArchiveReader{files: zr.File}
+	default:
+		return nil, ErrArchiveFormatInvalid
+	}
+
+	// metadata is the first entry
+	name, er, err := ar.Next()
+	if err != nil {
+		return nil, err
+	}
+	if name != archiveMetadataName {
+		return nil, fmt.Errorf("%w: first entry must be %s", ErrArchiveInvalid, archiveMetadataName)
+	}
+	h := sha256.New()
+	d, err := ioutil.ReadAll(io.TeeReader(er, h))
+	if err != nil {
+		return nil, err
+	}
+	received := map[string]*storager.Checksum{
+		name: {Size: int64(len(d)), SHA256: hex.EncodeToString(h.Sum(nil))},
+	}
+	list := AppList{}
+	if err := json.Unmarshal(d, &list); err != nil {
+		return nil, err
+	}
+
+	// files of new apps, archive entry name to storage name
+	s.lock.RLock()
+	exists := map[string]bool{}
+	for _, app := range s.list {
+		exists[app.ID] = true
+	}
+	s.lock.RUnlock()
+	wanted := map[string]string{}
+	for _, app := range list {
+		if err := tryMatchID(app.ID); err != nil {
+			return nil, fmt.Errorf("%w: app id %s", ErrArchiveInvalid, app.ID)
+		}
+		if exists[app.ID] {
+			continue
+		}
+		for _, n := range app.StorageNames() {
+			if !s.safeStorageName(n) {
+				return nil, fmt.Errorf("%w: storage name %s", ErrArchiveInvalid, n)
+			}
+			wanted[archiveFileName(n)] = n
+		}
+	}
+
+	// save files to temp dir, move to target after verified
+	temps := map[string]string{}
+	// files pending until saved to metadata
+	pending := []string{}
+	defer func() {
+		for _, t := range temps {
+			s.store.Delete(t)
+		}
+		s.setPending(false, pending...)
+	}()
+	var manifest *ArchiveManifest
+	for {
+		name, er, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name == archiveManifestName {
+			manifest = &ArchiveManifest{}
+			if err := json.NewDecoder(er).Decode(manifest); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, ok := wanted[name]; !ok {
+			continue
+		}
+		temp := tempStorageName()
+		s.setPending(true, temp)
+		pending = append(pending, temp)
+		h := sha256.New()
+		cr := &countWriter{}
+		if err := s.store.Save(temp, io.TeeReader(er, io.MultiWriter(h, cr))); err != nil {
+			return nil, err
+		}
+		temps[name] = temp
+		received[name] = &storager.Checksum{Size: cr.n, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: %s not found", ErrArchiveInvalid, archiveManifestName)
+	}
+	for name, sum := range received {
+		if want, ok := manifest.Files[name]; !ok || *want != *sum {
+			return nil, fmt.Errorf("%w: checksum of %s not match", ErrArchiveInvalid, name)
+		}
+	}
+
+	result := &ImportResult{Added: []string{}, Skipped: []string{}, Missing: []string{}}
+	added := AppList{}
+	// storage names in archive to names files moved to, shared by alias apps
+	moved := map[string]string{}
+	for _, app := range list {
+		if exists[app.ID] {
+			result.Skipped = append(result.Skipped, app.ID)
+			continue
+		}
+		pkg := app.PackageStorageName()
+		if _, ok := temps[archiveFileName(pkg)]; !ok && moved[pkg] == "" {
+			result.Missing = append(result.Missing, app.ID)
+			continue
+		}
+		for _, n := range app.StorageNames() {
+			target, ok := moved[n]
+			if !ok {
+				temp, ok := temps[archiveFileName(n)]
+				if !ok {
+					// NOTE: icon missing, keep app without icon
+					app.NoneIcon = true
+					continue
+				}
+				var same bool
+				target, same, err = s.importName(n, received[archiveFileName(n)])
+				if err != nil {
+					return nil, err
+				}
+				if !same {
+					s.setPending(true, target)
+					pending = append(pending, target)
+					if err := s.store.Move(temp, target); err != nil {
+						return nil, err
+					}
+					delete(temps, archiveFileName(n))
+				}
+				moved[n] = target
+			}
+			if target == n {
+				continue
+			}
+			if n == pkg {
+				app.StorageName = target
+			} else {
+				app.IconName = target
+			}
+		}
+		added = append(added, app)
+		result.Added = append(result.Added, app.ID)
+	}
+	if len(added) == 0 {
+		return result, nil
+	}
+
+	s.lock.Lock()
+	// skip apps added while importing
+	for _, app := range s.list {
+		exists[app.ID] = true
+	}
+	for _, app := range added {
+		if !exists[app.ID] {
+			s.list = append(s.list, app)
+		}
+	}
+	sort.Sort(s.list)
+	s.lock.Unlock()
+
+	return result, s.saveMetadata()
+}
+
+// relative path inside storage, not metadata or private files of service and storage
+func (s *service) safeStorageName(name string) bool {
+	c := path.Clean(filepath.ToSlash(name))
+	if c == "." || c == ".." || path.IsAbs(c) || strings.HasPrefix(c, "../") {
+		return false
+	}
+	if c == path.Clean(filepath.ToSlash(s.metadataName)) {
+		return false
+	}
+	for _, dir := range append(PrivateDirs(), storager.EncryptKeyDir) {
+		if c == dir || strings.HasPrefix(c, dir+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// storage name to move imported file to, never overwrite file with other content.
+// same is true if file with same checksum already saved as name,
+// file renamed if name used by other app or saved with other content
+func (s *service) importName(name string, sum *storager.Checksum) (target string, same bool, err error) {
+	s.lock.RLock()
+	refs := s.storageRefs(name)
+	s.lock.RUnlock()
+	saved, err := s.storageExists(name)
+	if err != nil {
+		return "", false, err
+	}
+	if saved {
+		got, err := s.storageChecksum(name)
+		if err != nil {
+			return "", false, err
+		}
+		if *got == *sum {
+			return name, true, nil
+		}
+	} else if refs == 0 {
+		return name, false, nil
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" + uuid.NewString() + ext, false, nil
+}
+
+// checksum of file saved in storage
+func (s *service) storageChecksum(name string) (*storager.Checksum, error) {
+	f, err := s.store.OpenMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return &storager.Checksum{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func testAddAppFiles(t *testing.T, s *service, id, identifier string) *AppInfo {
+	app := testAddApp(s, id, identifier)
+	app.NoneIcon = false
+	for _, name := range app.StorageNames() {
+		if err := s.store.Save(name, bytes.NewBufferString(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return app
+}
+
+func TestExportImport(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveFormatTar, ArchiveFormatZip} {
+		src := newTestService()
+		testAddAppFiles(t, src, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+		testAddAppFiles(t, src, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+
+		buf := &bytes.Buffer{}
+		if err := src.Export(buf, format); err != nil {
+			t.Fatal(err)
+		}
+		archive := buf.Bytes()
+
+		dest := newTestService()
+		testAddAppFiles(t, dest, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+		result, err := dest.Import(bytes.NewReader(archive), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Added) != 1 || result.Added[0] != "bbbbbbbbbbbbbbbbbbbbbb" || len(result.Skipped) != 1 {
+			t.Fatalf("%s: import result not match: %+v", format, result)
+		}
+		if len(dest.list) != 2 {
+			t.Fatalf("%s: want 2 apps got %d", format, len(dest.list))
+		}
+		r, err := dest.store.OpenMetadata("com.ineva.b/bbbbbbbbbbbbbbbbbbbbbb.ipa")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(r)
+		r.Close()
+		if string(b) != "com.ineva.b/bbbbbbbbbbbbbbbbbbbbbb.ipa" {
+			t.Fatalf("%s: package not match: %s", format, b)
+		}
+
+		// import again without duplicates
+		result, err = dest.Import(bytes.NewReader(archive), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Added) != 0 || len(dest.list) != 2 {
+			t.Fatalf("%s: duplicated import: %+v", format, result)
+		}
+	}
+
+	// tampered package
+	src := newTestService()
+	app := testAddAppFiles(t, src, "cccccccccccccccccccccc", "com.ineva.c")
+	if err := src.store.Save(app.IconStorageName(), bytes.NewBufferString("icon-data")); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := src.Export(buf, ArchiveFormatTar); err != nil {
+		t.Fatal(err)
+	}
+	archive := bytes.Replace(buf.Bytes(), []byte("icon-data"), []byte("ICON-DATA"), 1)
+	dest := newTestService()
+	if _, err := dest.Import(bytes.NewReader(archive), ArchiveFormatTar); !errors.Is(err, ErrArchiveInvalid) {
+		t.Fatalf("want ErrArchiveInvalid got %v", err)
+	}
+	if len(dest.list) != 0 {
+		t.Fatal("tampered archive imported")
+	}
+}
+
+func TestImportStorageName(t *testing.T) {
+	// private files never overwritten
+	for _, name := range []string{"appList.json", ".ipa_encryption_keys/x.ipa", ".ipa_parser_temp/x.ipa"} {
+		src := newTestService()
+		app := testAddApp(src, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+		app.StorageName = name
+		if err := src.store.Save(name, bytes.NewBufferString("package")); err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		if err := src.Export(buf, ArchiveFormatTar); err != nil {
+			t.Fatal(err)
+		}
+		dest := newTestService()
+		if _, err := dest.Import(buf, ArchiveFormatTar); !errors.Is(err, ErrArchiveInvalid) {
+			t.Fatalf("%s: want ErrArchiveInvalid got %v", name, err)
+		}
+	}
+
+	// file of existing app renamed, same file reused
+	src := newTestService()
+	a := testAddApp(src, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	a.StorageName = "shared/a.ipa"
+	b := testAddApp(src, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+	b.StorageName = "shared/b.ipa"
+	src.store.Save("shared/a.ipa", bytes.NewBufferString("package a"))
+	src.store.Save("shared/b.ipa", bytes.NewBufferString("package b"))
+	buf := &bytes.Buffer{}
+	if err := src.Export(buf, ArchiveFormatTar); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := newTestService()
+	c := testAddApp(dest, "cccccccccccccccccccccc", "com.ineva.c")
+	c.StorageName = "shared/a.ipa"
+	dest.store.Save("shared/a.ipa", bytes.NewBufferString("package c"))
+	dest.store.Save("shared/b.ipa", bytes.NewBufferString("package b"))
+	if _, err := dest.Import(buf, ArchiveFormatTar); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		r, err := dest.store.OpenMetadata(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, _ := ioutil.ReadAll(r)
+		return string(b)
+	}
+	if got := read("shared/a.ipa"); got != "package c" {
+		t.Fatalf("file of existing app overwritten: %s", got)
+	}
+	imported, _ := dest.find(a.ID)
+	if imported == nil || imported.StorageName == "shared/a.ipa" || read(imported.StorageName) != "package a" {
+		t.Fatalf("conflict file not renamed: %+v", imported)
+	}
+	if imported, _ := dest.find(b.ID); imported == nil || imported.StorageName != "shared/b.ipa" {
+		t.Fatalf("same file not reused: %+v", imported)
+	}
+}
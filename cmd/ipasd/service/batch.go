@@ -0,0 +1,202 @@
+package service
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrBatchActionInvalid = errors.New("batch action invalid")
+	ErrBatchTargetEmpty   = errors.New("ids or filter required")
+)
+
+// BatchAction operation applied to each app of batch
+type BatchAction string
+
+const (
+	// move to trash, locked apps are skipped
+	BatchDelete = BatchAction("delete")
+	BatchPin    = BatchAction("pin")
+	BatchUnpin  = BatchAction("unpin")
+	BatchLock   = BatchAction("lock")
+	BatchUnlock = BatchAction("unlock")
+	// add or remove Tags of request
+	BatchTag   = BatchAction("tag")
+	BatchUntag = BatchAction("untag")
+	// promote to Track of request, the last app of each identifier holds the track
+	BatchTrack = BatchAction("track")
+)
+
+// BatchFilter select apps, empty fields match all
+type BatchFilter struct {
+	// glob pattern of identifier and channel, path.Match syntax
+	Identifier string `json:"identifier,omitempty"`
+	Channel    string `json:"channel,omitempty"`
+	// version range, both inclusive
+	MinVersion string `json:"minVersion,omitempty"`
+	MaxVersion string `json:"maxVersion,omitempty"`
+	// upload date range, both inclusive
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+}
+
+func (f *BatchFilter) empty() bool {
+	return f == nil || *f == BatchFilter{}
+}
+
+func (f *BatchFilter) match(app *AppInfo) bool {
+	if f == nil {
+		return true
+	}
+	if !globMatch(f.Identifier, app.Identifier) || !globMatch(f.Channel, app.Channel) {
+		return false
+	}
+	if f.MinVersion != "" && compareVersion(app.Version, f.MinVersion) < 0 {
+		return false
+	}
+	if f.MaxVersion != "" && compareVersion(app.Version, f.MaxVersion) > 0 {
+		return false
+	}
+	if !f.Since.IsZero() && app.Date.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && app.Date.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// BatchRequest apply action to apps of IDs, or apps matched by filter if IDs empty.
+// IDs not matched by filter are skipped if both set.
+type BatchRequest struct {
+	Action BatchAction  `json:"action"`
+	IDs    []string     `json:"ids,omitempty"`
+	Filter *BatchFilter `json:"filter,omitempty"`
+	Tags   []string     `json:"tags,omitempty"`
+	Track  string       `json:"track,omitempty"`
+	// who promote apps to track, basic auth user if auth enabled
+	Actor string `json:"actor,omitempty"`
+}
+
+// BatchItemResult result of each app
+type BatchItemResult struct {
+	ID  string `json:"id"`
+	OK  bool   `json:"ok"`
+	Err string `json:"err,omitempty"`
+}
+
+type BatchResult struct {
+	Results []*BatchItemResult `json:"results"`
+}
+
+func (r *BatchRequest) validate() error {
+	switch r.Action {
+	case BatchDelete, BatchPin, BatchUnpin, BatchLock, BatchUnlock:
+	case BatchTag, BatchUntag:
+		if len(r.Tags) == 0 {
+			return errors.New("tags required")
+		}
+	case BatchTrack:
+		if err := ValidTrack(r.Track); err != nil {
+			return err
+		}
+	default:
+		return ErrBatchActionInvalid
+	}
+	if len(r.IDs) == 0 && r.Filter.empty() {
+		return ErrBatchTargetEmpty
+	}
+	return nil
+}
+
+// apply action to app, lock must be held
+func (r *BatchRequest) apply(s *service, app *AppInfo) error {
+	switch r.Action {
+	case BatchDelete:
+		if app.Locked {
+			return ErrAppLocked
+		}
+		now := time.Now()
+		app.DeletedAt = &now
+	case BatchPin:
+		app.Pinned = true
+	case BatchUnpin:
+		app.Pinned = false
+	case BatchLock:
+		app.Locked = true
+	case BatchUnlock:
+		app.Locked = false
+	case BatchTag:
+		for _, tag := range r.Tags {
+			if !hasTag(app.Tags, tag) {
+				app.Tags = append(app.Tags, tag)
+			}
+		}
+	case BatchUntag:
+		tags := []string{}
+		for _, tag := range app.Tags {
+			if !hasTag(r.Tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		app.Tags = tags
+	case BatchTrack:
+		s.promote(app, r.Track, r.Actor)
+	}
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Batch apply action to many apps with one metadata save
+func (s *service) Batch(r *BatchRequest) (*BatchResult, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Results: []*BatchItemResult{}}
+	changed := false
+	s.lock.Lock()
+	targets := AppList{}
+	if len(r.IDs) > 0 {
+		for _, id := range r.IDs {
+			app, err := s.find(id)
+			if err != nil {
+				result.Results = append(result.Results, &BatchItemResult{ID: id, Err: err.Error()})
+				continue
+			}
+			if !r.Filter.match(app) {
+				result.Results = append(result.Results, &BatchItemResult{ID: id, Err: "not matched by filter"})
+				continue
+			}
+			targets = append(targets, app)
+		}
+	} else {
+		for _, app := range s.list {
+			if !app.Trashed() && r.Filter.match(app) {
+				targets = append(targets, app)
+			}
+		}
+	}
+	for _, app := range targets {
+		if err := r.apply(s, app); err != nil {
+			result.Results = append(result.Results, &BatchItemResult{ID: app.ID, Err: err.Error()})
+			continue
+		}
+		changed = true
+		result.Results = append(result.Results, &BatchItemResult{ID: app.ID, OK: true})
+	}
+	s.lock.Unlock()
+
+	if !changed {
+		return result, nil
+	}
+	return result, s.saveMetadata()
+}
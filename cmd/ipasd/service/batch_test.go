@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	s := newTestService()
+	a1 := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa1", "com.ineva.a")
+	a2 := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa2", "com.ineva.a")
+	a2.Version = "1.10"
+	a3 := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa3", "com.ineva.a")
+	a3.Version = "2.0"
+	a3.Locked = true
+	b := testAddAppFiles(t, s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+	b.Date = time.Now().Add(-48 * time.Hour)
+
+	if _, err := s.Batch(&BatchRequest{Action: BatchDelete}); err != ErrBatchTargetEmpty {
+		t.Fatalf("want ErrBatchTargetEmpty got %v", err)
+	}
+	if _, err := s.Batch(&BatchRequest{Action: "foo", IDs: []string{a1.ID}}); err != ErrBatchActionInvalid {
+		t.Fatalf("want ErrBatchActionInvalid got %v", err)
+	}
+
+	// tag by version range
+	result, err := s.Batch(&BatchRequest{
+		Action: BatchTag,
+		Filter: &BatchFilter{Identifier: "com.ineva.*", MinVersion: "1.2", MaxVersion: "2.0"},
+		Tags:   []string{"ci-42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Results) != 2 || len(a2.Tags) != 1 || len(a3.Tags) != 1 || len(a1.Tags) != 0 {
+		t.Fatalf("tag result not match: %+v", result.Results)
+	}
+
+	// delete by date range, locked app skipped
+	result, err = s.Batch(&BatchRequest{
+		Action: BatchDelete,
+		Filter: &BatchFilter{Since: time.Now().Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []string{}
+	for _, r := range result.Results {
+		msgs = append(msgs, r.ID+":"+r.Err)
+	}
+	if got := strings.Join(msgs, " "); got != a3.ID+":"+ErrAppLocked.Error()+" "+a2.ID+": "+a1.ID+":" {
+		t.Fatalf("delete result not match: %s", got)
+	}
+	if !a1.Trashed() || !a2.Trashed() || a3.Trashed() || b.Trashed() {
+		t.Fatal("apps not deleted by filter")
+	}
+
+	// ids, trashed apps not found
+	result, err = s.Batch(&BatchRequest{Action: BatchPin, IDs: []string{a1.ID, b.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Results[0].OK || result.Results[0].Err != ErrIdNotFound.Error() || !result.Results[1].OK || !b.Pinned {
+		t.Fatalf("pin result not match: %+v %+v", result.Results[0], result.Results[1])
+	}
+}
+
+func TestCompareVersion(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0.0", 0},
+		{"1.10", "1.9", 1},
+		{"1.2.3", "1.12", -1},
+		{"2.0", "2.0-beta", 1},
+		{"1.0-alpha", "1.0-beta", -1},
+		{"1.10-rc", "1.9", 1},
+		{"1.10-rc", "1.10", -1},
+		{"1.10-rc1", "1.10-rc2", -1},
+		{"1.010", "1.10", 0},
+		{"1.0", "1.beta", 1},
+	}
+	for _, c := range cases {
+		if got := compareVersion(c.a, c.b); got != c.want {
+			t.Fatalf("compare %s %s: want %d got %d", c.a, c.b, c.want, got)
+		}
+	}
+}
+
+func TestDecodeBatchActor(t *testing.T) {
+	body := `{"action": "track", "ids": ["aaaaaaaaaaaaaaaaaaaaaa"], "track": "beta", "actor": "someone"}`
+	r := httptest.NewRequest("POST", "/api/batch", strings.NewReader(body))
+	req, err := DecodeBatchRequest(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := req.(*BatchRequest); p.Actor != "someone" {
+		t.Fatalf("want actor of body got %s", p.Actor)
+	}
+
+	r = httptest.NewRequest("POST", "/api/batch", strings.NewReader(body))
+	r.SetBasicAuth("admin", "pass")
+	req, err = DecodeBatchRequest(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := req.(*BatchRequest); p.Actor != "admin" {
+		t.Fatalf("want basic auth user got %s", p.Actor)
+	}
+}
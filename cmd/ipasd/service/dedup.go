@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+// DedupPolicy how to handle package uploaded again with same identifier and sha256
+type DedupPolicy string
+
+const (
+	// save every upload
+	DedupOff = DedupPolicy("off")
+	// return existing app, no new app added
+	DedupExisting = DedupPolicy("existing")
+	// add new app point at files of existing app
+	DedupAlias = DedupPolicy("alias")
+)
+
+var (
+	ErrDedupPolicyInvalid = errors.New("dedup policy invalid, off existing or alias only")
+)
+
+func ParseDedupPolicy(p string) (DedupPolicy, error) {
+	switch DedupPolicy(strings.ToLower(p)) {
+	case DedupOff, "":
+		return DedupOff, nil
+	case DedupExisting:
+		return DedupExisting, nil
+	case DedupAlias:
+		return DedupAlias, nil
+	}
+	return "", ErrDedupPolicyInvalid
+}
+
+// find app with same package, lock must be held
+func (s *service) findDuplicate(app *AppInfo) *AppInfo {
+	if app.SHA256 == "" {
+		return nil
+	}
+	for _, row := range s.list {
+		if row.Identifier == app.Identifier && row.Type == app.Type && row.SHA256 == app.SHA256 && !row.Trashed() {
+			return row
+		}
+	}
+	return nil
+}
+
+// count apps reference storage name, lock must be held
+func (s *service) storageRefs(name string) int {
+	n := 0
+	for _, row := range s.list {
+		for _, n2 := range row.StorageNames() {
+			if n2 == name {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
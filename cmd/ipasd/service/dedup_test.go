@@ -0,0 +1,85 @@
+package service
+
+import (
+	"os"
+	"testing"
+)
+
+func testAddIpa(t *testing.T, s *service) *AppInfo {
+	f, err := os.Open("../../../pkg/ipa/test_data/ipa.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := s.Add(f, fi.Size(), AppInfoTypeIpa, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestDedupOff(t *testing.T) {
+	s := newTestService()
+	a := testAddIpa(t, s)
+	b := testAddIpa(t, s)
+	if a.SHA256 == "" || a.SHA256 != b.SHA256 {
+		t.Fatalf("sha256 not match: %s %s", a.SHA256, b.SHA256)
+	}
+	if len(s.list) != 2 || a.PackageStorageName() == b.PackageStorageName() {
+		t.Fatal("want 2 apps with own package")
+	}
+}
+
+func TestDedupExisting(t *testing.T) {
+	s := newTestService(WithDedupPolicy(DedupExisting))
+	a := testAddIpa(t, s)
+	b := testAddIpa(t, s)
+	if a.ID != b.ID || len(s.list) != 1 {
+		t.Fatalf("want existing app %s got %s", a.ID, b.ID)
+	}
+}
+
+func TestDedupAlias(t *testing.T) {
+	s := newTestService(WithDedupPolicy(DedupAlias))
+	a := testAddIpa(t, s)
+	b := testAddIpa(t, s)
+	if a.ID == b.ID || len(s.list) != 2 {
+		t.Fatal("want alias app")
+	}
+	if a.PackageStorageName() != b.PackageStorageName() || a.IconStorageName() != b.IconStorageName() {
+		t.Fatal("alias should share files")
+	}
+	if n := len(s.StorageNames()); n != 1+len(a.StorageNames()) {
+		t.Fatalf("want shared names once got %d", n)
+	}
+
+	// files kept until the last reference purged
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Purge(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range b.StorageNames() {
+		r, err := s.store.OpenMetadata(name)
+		if err != nil {
+			t.Fatalf("shared file %s deleted", name)
+		}
+		r.Close()
+	}
+	if err := s.Delete(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Purge(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range b.StorageNames() {
+		if _, err := s.store.OpenMetadata(name); err == nil {
+			t.Fatalf("file %s not deleted", name)
+		}
+	}
+}
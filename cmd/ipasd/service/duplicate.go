@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DuplicatePolicy how to handle package uploaded with same identifier, version, build, channel and type of existing app
+type DuplicatePolicy string
+
+const (
+	// add new app
+	DuplicateAllow = DuplicatePolicy("allow")
+	// refuse upload with ConflictError
+	DuplicateReject = DuplicatePolicy("reject")
+	// new app replace existing app, keep its ID and links
+	DuplicateReplace = DuplicatePolicy("replace")
+)
+
+var (
+	ErrDuplicatePolicyInvalid = errors.New("duplicate policy invalid, allow reject or replace only")
+	ErrDuplicateBuild         = errors.New("app with same version and build exists")
+	ErrVersionCodeLower       = errors.New("versionCode lower than the latest app")
+)
+
+func ParseDuplicatePolicy(p string) (DuplicatePolicy, error) {
+	switch DuplicatePolicy(strings.ToLower(p)) {
+	case DuplicateAllow, "":
+		return DuplicateAllow, nil
+	case DuplicateReject:
+		return DuplicateReject, nil
+	case DuplicateReplace:
+		return DuplicateReplace, nil
+	}
+	return "", ErrDuplicatePolicyInvalid
+}
+
+// ConflictError upload conflict with existing app, responded as 409
+type ConflictError struct {
+	Err error
+	// existing app
+	ID string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%v, existing app id: %s", e.Err, e.ID)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConflictError) StatusCode() int {
+	return http.StatusConflict
+}
+
+func (e *ConflictError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"err": e.Error(), "id": e.ID})
+}
+
+// find app with same version and build, lock must be held
+func (s *service) findSameBuild(app *AppInfo) *AppInfo {
+	for _, row := range s.list {
+		if row.Identifier == app.Identifier && row.Type == app.Type && row.Channel == app.Channel &&
+			row.Version == app.Version && row.Build == app.Build && !row.Trashed() {
+			return row
+		}
+	}
+	return nil
+}
+
+// find apk with the highest versionCode of identifier, lock must be held
+func (s *service) findLatestVersionCode(app *AppInfo) *AppInfo {
+	var latest *AppInfo
+	for _, row := range s.list {
+		if row.Identifier == app.Identifier && row.Type == AppInfoTypeApk && !row.Trashed() {
+			if latest == nil || compareVersion(row.Build, latest.Build) > 0 {
+				latest = row
+			}
+		}
+	}
+	return latest
+}
+
+// check new app against duplicate policy and strict versionCode, app to replace takes ID of existing app
+func (s *service) checkBuild(app *AppInfo) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.strictVersionCode && app.Type == AppInfoTypeApk {
+		if latest := s.findLatestVersionCode(app); latest != nil && compareVersion(app.Build, latest.Build) < 0 {
+			return &ConflictError{Err: ErrVersionCodeLower, ID: latest.ID}
+		}
+	}
+	if s.duplicatePolicy == DuplicateAllow {
+		return nil
+	}
+	dup := s.findSameBuild(app)
+	if dup == nil {
+		return nil
+	}
+	if s.duplicatePolicy == DuplicateReject {
+		return &ConflictError{Err: ErrDuplicateBuild, ID: dup.ID}
+	}
+	if dup.Locked {
+		return &ConflictError{Err: ErrAppLocked, ID: dup.ID}
+	}
+	app.ID = dup.ID
+	return nil
+}
+
+// remove existing app with same ID from list, new app keep fields set by users, lock must be held.
+// return replaced app, nil if not found
+func (s *service) replace(app *AppInfo) *AppInfo {
+	for i, row := range s.list {
+		if row.ID != app.ID {
+			continue
+		}
+		app.Pinned, app.Locked, app.Tags = row.Pinned, row.Locked, row.Tags
+		app.Tracks, app.Promotions, app.DisplayName = row.Tracks, row.Promotions, row.DisplayName
+		if app.Notes == "" {
+			app.Notes = row.Notes
+		}
+		s.list = append(s.list[:i], s.list[i+1:]...)
+		return row
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestDuplicateReject(t *testing.T) {
+	s := newTestService(WithDuplicatePolicy(DuplicateReject))
+	a := testAddIpa(t, s)
+
+	f, err := os.Open("../../../pkg/ipa/test_data/ipa.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, _ := f.Stat()
+	_, err = s.Add(f, fi.Size(), AppInfoTypeIpa, nil)
+	conflict := &ConflictError{}
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrDuplicateBuild) || conflict.ID != a.ID || conflict.StatusCode() != 409 {
+		t.Fatalf("want conflict with %s got %v", a.ID, err)
+	}
+	b, _ := json.Marshal(conflict)
+	if m := map[string]string{}; json.Unmarshal(b, &m) != nil || m["id"] != a.ID {
+		t.Fatalf("id not in response: %s", b)
+	}
+	if len(s.list) != 1 {
+		t.Fatal("rejected app added")
+	}
+	names, _ := s.store.List(tempDir)
+	if len(names) != 0 {
+		t.Fatalf("temp files not deleted: %v", names)
+	}
+}
+
+func TestDuplicateReplace(t *testing.T) {
+	s := newTestService(WithDuplicatePolicy(DuplicateReplace))
+	a := testAddIpa(t, s)
+	if err := s.SetPinned(a.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	b := testAddIpa(t, s)
+	if b.ID != a.ID || len(s.list) != 1 || !b.Pinned {
+		t.Fatalf("app not replaced: %+v", s.list)
+	}
+	if b.PackageStorageName() == a.PackageStorageName() {
+		t.Fatal("want package of new app")
+	}
+	names, err := s.store.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if name == a.PackageStorageName() {
+			t.Fatal("package of replaced app not deleted")
+		}
+	}
+
+	// locked app never replaced
+	if err := s.SetLocked(b.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("../../../pkg/ipa/test_data/ipa.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, _ := f.Stat()
+	if _, err := s.Add(f, fi.Size(), AppInfoTypeIpa, nil); !errors.Is(err, ErrAppLocked) {
+		t.Fatalf("want ErrAppLocked got %v", err)
+	}
+}
+
+func TestStrictVersionCode(t *testing.T) {
+	s := newTestService(WithStrictVersionCode(true))
+	a := testAddApp(s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	a.Type, a.Build = AppInfoTypeApk, "100"
+
+	for build, want := range map[string]error{"99": ErrVersionCodeLower, "100": nil, "101": nil} {
+		app := &AppInfo{ID: "bbbbbbbbbbbbbbbbbbbbbb", Identifier: "com.ineva.a", Type: AppInfoTypeApk, Build: build}
+		if err := s.checkBuild(app); !errors.Is(err, want) {
+			t.Fatalf("%s: want %v got %v", build, want, err)
+		}
+	}
+	// ipa not checked
+	if err := s.checkBuild(&AppInfo{Identifier: "com.ineva.a", Build: "1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDuplicateWithDedup(t *testing.T) {
+	for _, dedup := range []DedupPolicy{DedupExisting, DedupAlias} {
+		s := newTestService(WithDedupPolicy(dedup), WithDuplicatePolicy(DuplicateReject))
+		a := testAddIpa(t, s)
+
+		f, err := os.Open("../../../pkg/ipa/test_data/ipa.ipa")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, _ := f.Stat()
+		_, err = s.Add(f, fi.Size(), AppInfoTypeIpa, nil)
+		f.Close()
+		conflict := &ConflictError{}
+		if !errors.As(err, &conflict) || conflict.ID != a.ID {
+			t.Fatalf("%s: want conflict with %s got %v", dedup, a.ID, err)
+		}
+	}
+}
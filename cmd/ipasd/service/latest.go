@@ -0,0 +1,19 @@
+package service
+
+import "time"
+
+// Latest first build of identifier by ordering, empty channel to match all channels, AppInfoTypeUnknown to match all types
+func (s *service) Latest(identifier, channel string, t AppInfoType, publicURL string) (*Item, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	now := time.Now()
+	for _, app := range s.sorted() {
+		if app.Trashed() || !app.Visible(now) || app.Identifier != identifier {
+			continue
+		}
+		if (channel == "" || app.Channel == channel) && (t == AppInfoTypeUnknown || app.Type == t) {
+			return s.itemInfo(app, publicURL), nil
+		}
+	}
+	return nil, ErrIdNotFound
+}
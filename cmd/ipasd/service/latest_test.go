@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatest(t *testing.T) {
+	s := newTestService()
+	old := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa1", "com.ineva.a")
+	old.Date = time.Now().Add(-time.Hour)
+	beta := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa2", "com.ineva.a")
+	beta.Channel = "beta"
+	apk := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa3", "com.ineva.a")
+	apk.Type = AppInfoTypeApk
+	e := MakeLatestEndpoint(s)
+
+	for path, want := range map[string]string{
+		"/latest/com.ineva.a":               "/app/?id=" + apk.ID,
+		"/latest/com.ineva.a.ipa":           beta.PackageStorageName(),
+		"/latest/com.ineva.a.apk":           apk.PackageStorageName(),
+		"/latest/com.ineva.a/beta.plist":    beta.PackageStorageName(),
+		"/latest/com.ineva.a/icon.png":      apk.IconStorageName(),
+		"/latest/com.ineva.a/beta/icon.png": beta.IconStorageName(),
+		"/latest/com.ineva.a/beta":          "/app/?id=" + beta.ID,
+		"/latest/com.ineva.a/release.plist": "",
+	} {
+		req, err := DecodeLatestRequest(context.Background(), httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := e(context.Background(), req)
+		if want == "" {
+			if err != ErrIdNotFound {
+				t.Fatalf("%s: want ErrIdNotFound got %v", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		if err := EncodeResolveResponse(context.Background(), w, resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Header().Get("Location") + w.Body.String(); !strings.Contains(got, want) {
+			t.Fatalf("%s: want %s got %s", path, want, got)
+		}
+	}
+
+	// resolved again after new build
+	if err := s.Delete(beta.ID); err != nil {
+		t.Fatal(err)
+	}
+	if item, err := s.Latest("com.ineva.a", "", AppInfoTypeIpa, ""); err != nil || item.ID != old.ID {
+		t.Fatalf("latest not resolved again: %v %v", item, err)
+	}
+	if _, err := DecodeLatestRequest(context.Background(), httptest.NewRequest("GET", "/latest/a/b/c.ipa", nil)); err == nil {
+		t.Fatal("invalid path decoded")
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	stdLog "log"
 	"time"
@@ -12,6 +13,10 @@ import (
 	"github.com/go-kit/kit/log/level"
 )
 
+var (
+	ErrAuthRequired = errors.New("basic auth required, set -user to enable it")
+)
+
 func LoggingMiddleware(logger log.Logger, name string, debug bool) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		var logging log.Logger
@@ -63,3 +68,15 @@ func BasicAuthMiddleware(user, pass, realm string) endpoint.Middleware {
 	stdLog.Println(user, pass, realm)
 	return basic.AuthMiddleware(user, pass, realm)
 }
+
+// AuthRequiredMiddleware same as BasicAuthMiddleware, but refuse all requests if user not set
+func AuthRequiredMiddleware(user, pass, realm string) endpoint.Middleware {
+	if user == "" {
+		return func(e endpoint.Endpoint) endpoint.Endpoint {
+			return func(ctx context.Context, request interface{}) (interface{}, error) {
+				return nil, ErrAuthRequired
+			}
+		}
+	}
+	return basic.AuthMiddleware(user, pass, realm)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+)
+
+var (
+	ErrPatchEmpty = errors.New("name, notes, publishAt or expireAt required")
+)
+
+// AppPatch fields of app to edit, nil fields are not changed
+type AppPatch struct {
+	// display name, empty to restore name from package
+	Name  *string `json:"name,omitempty"`
+	Notes *string `json:"notes,omitempty"`
+	// RFC3339 time, empty to remove
+	PublishAt *string `json:"publishAt,omitempty"`
+	ExpireAt  *string `json:"expireAt,omitempty"`
+}
+
+// Edit change display name, release notes, publish and expire time of app
+func (s *service) Edit(id string, p *AppPatch) error {
+	if p.Name == nil && p.Notes == nil && p.PublishAt == nil && p.ExpireAt == nil {
+		return ErrPatchEmpty
+	}
+	var publishAt, expireAt *time.Time
+	var err error
+	if p.PublishAt != nil {
+		if publishAt, err = ParseScheduleTime(*p.PublishAt); err != nil {
+			return err
+		}
+	}
+	if p.ExpireAt != nil {
+		if expireAt, err = ParseScheduleTime(*p.ExpireAt); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	app, err := s.find(id)
+	if err == nil {
+		if p.PublishAt == nil {
+			publishAt = app.PublishAt
+		}
+		if p.ExpireAt == nil {
+			expireAt = app.ExpireAt
+		}
+		err = checkSchedule(publishAt, expireAt)
+	}
+	if err == nil {
+		if p.Name != nil {
+			app.DisplayName = strings.TrimSpace(*p.Name)
+		}
+		if p.Notes != nil {
+			app.Notes = *p.Notes
+		}
+		// events sent again for new time
+		if p.PublishAt != nil {
+			app.PublishAt = publishAt
+			app.Notified = removeTag(app.Notified, EventPublished)
+		}
+		if p.ExpireAt != nil {
+			app.ExpireAt = expireAt
+			app.Notified = removeTag(app.Notified, EventExpired)
+		}
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.saveMetadata()
+}
+
+// goldmark default renderer omits raw HTML and drops dangerous links like javascript:
+var markdown = goldmark.New()
+
+// render Markdown notes to HTML safe to insert into page
+func renderNotes(notes string) string {
+	if notes == "" {
+		return ""
+	}
+	buf := &bytes.Buffer{}
+	if err := markdown.Convert([]byte(notes), buf); err != nil {
+		// NOTE: ignore error, raw notes still returned
+		return ""
+	}
+	return buf.String()
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEdit(t *testing.T) {
+	s := newTestService()
+	a := testAddApp(s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	a.Name = "A"
+
+	name, notes := "  Beta A ", "# Fixes\n\n- crash <script>alert(1)</script>\n\n[link](javascript:alert(1))"
+	if err := s.Edit(a.ID, &AppPatch{Name: &name, Notes: &notes}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Edit(a.ID, &AppPatch{}); err != ErrPatchEmpty {
+		t.Fatalf("want ErrPatchEmpty got %v", err)
+	}
+	if err := s.Edit("cccccccccccccccccccccc", &AppPatch{Notes: &notes}); err != ErrIdNotFound {
+		t.Fatalf("want ErrIdNotFound got %v", err)
+	}
+
+	item, err := s.Find(a.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "Beta A" || item.Notes != notes {
+		t.Fatalf("app not edited: %+v", item)
+	}
+	if !strings.Contains(item.NotesHTML, "<h1>Fixes</h1>") {
+		t.Fatalf("notes not rendered: %s", item.NotesHTML)
+	}
+	if strings.Contains(item.NotesHTML, "<script>") || strings.Contains(item.NotesHTML, "javascript:") {
+		t.Fatalf("notes not sanitized: %s", item.NotesHTML)
+	}
+
+	// empty name restores name from package
+	empty := ""
+	if err := s.Edit(a.ID, &AppPatch{Name: &empty}); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := s.Find(a.ID, ""); item.Name != "A" || item.Notes != notes {
+		t.Fatalf("name not restored: %+v", item)
+	}
+}
+
+func TestDecodeAddRequestNotes(t *testing.T) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	if err := w.WriteField("notes", "release notes"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := w.CreateFormFile("file", "test.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("package"))
+	w.Close()
+
+	r := httptest.NewRequest("POST", "/api/upload", body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	r.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+	req, err := DecodeAddRequest(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := req.(addParam)
+	if p.opts.Notes != "release notes" || p.file.FileName() != "test.ipa" {
+		t.Fatalf("param not match: %+v", p)
+	}
+	if b, _ := ioutil.ReadAll(p.file); string(b) != "package" {
+		t.Fatalf("file not match: %s", b)
+	}
+}
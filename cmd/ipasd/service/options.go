@@ -0,0 +1,54 @@
+package service
+
+import "time"
+
+type Option func(*service)
+
+// keep the last n metadata snapshots, 0 to disable snapshots
+func WithSnapshotRetention(n int) Option {
+	return func(s *service) {
+		s.snapshotRetention = n
+	}
+}
+
+// how to handle package uploaded again, default DedupOff
+func WithDedupPolicy(p DedupPolicy) Option {
+	return func(s *service) {
+		s.dedupPolicy = p
+	}
+}
+
+// how to handle package uploaded with version and build of existing app, default DuplicateAllow
+func WithDuplicatePolicy(p DuplicatePolicy) Option {
+	return func(s *service) {
+		s.duplicatePolicy = p
+	}
+}
+
+// reject apk with versionCode lower than the latest apk of identifier
+func WithStrictVersionCode(strict bool) Option {
+	return func(s *service) {
+		s.strictVersionCode = strict
+	}
+}
+
+// keep trashed apps for d before purged by PurgeTrash, 0 to keep forever
+func WithTrashRetention(d time.Duration) Option {
+	return func(s *service) {
+		s.trashRetention = d
+	}
+}
+
+// builds to keep, nil to keep all builds
+func WithRetentionPolicy(p *RetentionPolicy) Option {
+	return func(s *service) {
+		s.retention = p
+	}
+}
+
+// order of builds to pick the current build, default OrderDate
+func WithOrdering(o Ordering) Option {
+	return func(s *service) {
+		s.ordering = o
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Ordering how to order builds of identifier, the first one is the current build
+type Ordering string
+
+const (
+	// newest upload first
+	OrderDate = Ordering("date")
+	// highest version first, then highest build number, then newest upload
+	OrderVersion = Ordering("version")
+)
+
+var (
+	ErrOrderingInvalid = errors.New("ordering invalid, date or version only")
+)
+
+func ParseOrdering(o string) (Ordering, error) {
+	switch Ordering(strings.ToLower(o)) {
+	case OrderDate, "":
+		return OrderDate, nil
+	case OrderVersion:
+		return OrderVersion, nil
+	}
+	return "", ErrOrderingInvalid
+}
+
+// before report a is ordered before b
+func (o Ordering) before(a, b *AppInfo) bool {
+	if o == OrderVersion {
+		// short version compared semantically, build number numerically: 1.10 > 1.9, 100 > 99
+		if c := compareVersion(a.Version, b.Version); c != 0 {
+			return c > 0
+		}
+		if c := compareVersion(a.Build, b.Build); c != 0 {
+			return c > 0
+		}
+	}
+	return a.Date.After(b.Date)
+}
+
+func (o Ordering) sort(list AppList) {
+	sort.SliceStable(list, func(i, j int) bool { return o.before(list[i], list[j]) })
+}
+
+// copy of apps sorted by ordering, lock must be held
+func (s *service) sorted() AppList {
+	list := make(AppList, len(s.list))
+	copy(list, s.list)
+	s.ordering.sort(list)
+	return list
+}
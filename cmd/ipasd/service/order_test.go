@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrdering(t *testing.T) {
+	if _, err := ParseOrdering("foo"); err != ErrOrderingInvalid {
+		t.Fatalf("want ErrOrderingInvalid got %v", err)
+	}
+
+	add := func(s *service, id, version, build string, age time.Duration) {
+		app := testAddApp(s, id, "com.ineva.a")
+		app.Version, app.Build, app.Date = version, build, time.Now().Add(-age)
+	}
+	for o, want := range map[Ordering]string{
+		OrderDate:    "aaaaaaaaaaaaaaaaaaaaa4 aaaaaaaaaaaaaaaaaaaaa3 aaaaaaaaaaaaaaaaaaaaa2 aaaaaaaaaaaaaaaaaaaaa1",
+		OrderVersion: "aaaaaaaaaaaaaaaaaaaaa2 aaaaaaaaaaaaaaaaaaaaa3 aaaaaaaaaaaaaaaaaaaaa1 aaaaaaaaaaaaaaaaaaaaa4",
+	} {
+		s := newTestService(WithOrdering(o))
+		add(s, "aaaaaaaaaaaaaaaaaaaaa1", "1.9", "100", 4*time.Hour)
+		add(s, "aaaaaaaaaaaaaaaaaaaaa2", "1.10", "99", 3*time.Hour)
+		add(s, "aaaaaaaaaaaaaaaaaaaaa3", "1.10", "9", 2*time.Hour)
+		// hotfix of older version uploaded last
+		add(s, "aaaaaaaaaaaaaaaaaaaaa4", "1.9-hotfix", "101", time.Hour)
+
+		history, err := s.History("aaaaaaaaaaaaaaaaaaaaa1", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, item := range history {
+			ids = append(ids, item.ID)
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Fatalf("%s: want %s got %s", o, want, got)
+		}
+
+		first := strings.Split(want, " ")[0]
+		d, err := s.List("", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list := d["list"].([]*Item); len(list) != 1 || list[0].ID != first {
+			t.Fatalf("%s: current build not %s", o, first)
+		}
+		if item, err := s.Latest("com.ineva.a", "", AppInfoTypeUnknown, ""); err != nil || item.ID != first {
+			t.Fatalf("%s: latest build not %s", o, first)
+		}
+	}
+}
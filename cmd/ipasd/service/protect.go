@@ -0,0 +1,29 @@
+package service
+
+// SetPinned pin app to the top of history and exempt it from retention pruning
+func (s *service) SetPinned(id string, pinned bool) error {
+	return s.update(id, func(app *AppInfo) {
+		app.Pinned = pinned
+	})
+}
+
+// SetLocked lock app to protect it from deletion and retention pruning
+func (s *service) SetLocked(id string, locked bool) error {
+	return s.update(id, func(app *AppInfo) {
+		app.Locked = locked
+	})
+}
+
+// update app of id and save metadata
+func (s *service) update(id string, fn func(app *AppInfo)) error {
+	s.lock.Lock()
+	app, err := s.find(id)
+	if err == nil {
+		fn(app)
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.saveMetadata()
+}
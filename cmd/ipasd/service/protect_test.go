@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPinLock(t *testing.T) {
+	s := newTestService()
+	a := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	b := testAddAppFiles(t, s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.a")
+
+	if err := s.SetPinned(a.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetLocked(a.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPinned("cccccccccccccccccccccc", true); err != ErrIdNotFound {
+		t.Fatalf("want ErrIdNotFound got %v", err)
+	}
+
+	history, err := s.History(b.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].ID != a.ID || !history[0].Pinned || !history[0].Locked {
+		t.Fatalf("pinned app not at the top: %+v", history)
+	}
+
+	del := MakeDeleteEndpoint(s, true)
+	if _, err := del(context.Background(), delParam{id: a.ID}); err != ErrAppLocked {
+		t.Fatalf("want ErrAppLocked got %v", err)
+	}
+	if err := s.SetLocked(a.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := del(context.Background(), delParam{id: a.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.find(a.ID); err != ErrIdNotFound {
+		t.Fatal("unlocked app not deleted")
+	}
+
+	// scheduled builds can be deleted, locked check in service
+	future := time.Now().Add(time.Hour)
+	b.PublishAt = &future
+	if err := s.SetLocked(b.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(b.ID); err != ErrAppLocked {
+		t.Fatalf("want ErrAppLocked got %v", err)
+	}
+	if err := s.SetLocked(b.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := del(context.Background(), delParam{id: b.ID}); err != nil {
+		t.Fatal(err)
+	}
+}
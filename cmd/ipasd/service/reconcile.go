@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+	"github.com/iineva/ipa-server/pkg/uuid"
+)
+
+// ReconcileResult storage names and app IDs found by Reconcile
+type ReconcileResult struct {
+	// packages and icons not referenced by metadata
+	Orphans []string `json:"orphans"`
+	// temp files left by failed or interrupted uploads
+	StaleTemps []string `json:"staleTemps"`
+	// apps whose package not found
+	Dangling []string `json:"dangling"`
+	// orphans and stale temps deleted, dangling apps removed from metadata
+	Fixed bool `json:"fixed"`
+}
+
+// temp files older than it are stale by default
+const DefaultTempAge = 24 * time.Hour
+
+// only files with these extensions can be orphans, other files in storager are never touched
+var orphanExts = []string{".ipa", ".apk", ".png"}
+
+// temp file name with create time, to find stale temp files left by other process
+func tempStorageName() string {
+	return filepath.Join(tempDir, fmt.Sprintf("%d_%s", time.Now().Unix(), uuid.NewString()))
+}
+
+// create time of temp file, zero if saved before time added to name
+func tempCreated(name string) time.Time {
+	i := strings.Index(path.Base(name), "_")
+	if i < 0 {
+		return time.Time{}
+	}
+	sec, err := strconv.ParseInt(path.Base(name)[:i], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// mark files being saved, pending files are not in metadata yet and should not be reconciled
+func (s *service) setPending(pending bool, names ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, name := range names {
+		if pending {
+			s.pending[filepath.ToSlash(name)] = true
+		} else {
+			delete(s.pending, filepath.ToSlash(name))
+		}
+	}
+}
+
+func isOrphanCandidate(name string) bool {
+	// wrapped keys are listed when storager not wrapped by encrypt storager, eg: mirrors
+	for _, dir := range append(PrivateDirs(), storager.EncryptKeyDir) {
+		if strings.HasPrefix(name, dir+"/") {
+			return false
+		}
+	}
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range orphanExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconcile compare files in storager with metadata.
+// tempAge: temp files older than it are stale, temp files of uploads in progress are never stale.
+// fix: delete orphans and stale temps, remove dangling apps from metadata.
+func (s *service) Reconcile(fix bool, tempAge time.Duration) (*ReconcileResult, error) {
+	// apps added after files listed are not dangling
+	s.lock.RLock()
+	before := map[string]bool{}
+	for _, app := range s.list {
+		before[app.ID] = true
+	}
+	s.lock.RUnlock()
+
+	list, err := s.store.List("")
+	if err != nil {
+		return nil, err
+	}
+	listed := map[string]bool{}
+	for _, name := range list {
+		listed[filepath.ToSlash(name)] = true
+	}
+
+	result := &ReconcileResult{Orphans: []string{}, StaleTemps: []string{}, Dangling: []string{}, Fixed: fix}
+	s.lock.RLock()
+	refs := map[string]bool{filepath.ToSlash(s.metadataName): true}
+	for _, app := range s.list {
+		for _, name := range app.StorageNames() {
+			refs[filepath.ToSlash(name)] = true
+		}
+		if before[app.ID] && !listed[filepath.ToSlash(app.PackageStorageName())] {
+			result.Dangling = append(result.Dangling, app.ID)
+		}
+	}
+	for _, name := range list {
+		name = filepath.ToSlash(name)
+		if s.pending[name] {
+			continue
+		}
+		if strings.HasPrefix(name, tempDir+"/") {
+			if time.Since(tempCreated(name)) > tempAge {
+				result.StaleTemps = append(result.StaleTemps, name)
+			}
+			continue
+		}
+		if !refs[name] && isOrphanCandidate(name) {
+			result.Orphans = append(result.Orphans, name)
+		}
+	}
+	s.lock.RUnlock()
+
+	if !fix {
+		return result, nil
+	}
+
+	var firstErr error
+	for _, name := range append(append([]string{}, result.Orphans...), result.StaleTemps...) {
+		if err := s.store.Delete(name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(result.Dangling) == 0 {
+		return result, firstErr
+	}
+
+	dangling := map[string]bool{}
+	for _, id := range result.Dangling {
+		dangling[id] = true
+	}
+	removed := AppList{}
+	s.lock.Lock()
+	kept := AppList{}
+	for _, app := range s.list {
+		if dangling[app.ID] {
+			removed = append(removed, app)
+		} else {
+			kept = append(kept, app)
+		}
+	}
+	s.list = kept
+	// icons still referenced by alias apps
+	shared := map[string]bool{}
+	for _, app := range removed {
+		if name := app.IconStorageName(); name != "" {
+			shared[name] = s.storageRefs(name) > 0
+		}
+	}
+	s.lock.Unlock()
+
+	if err := s.saveMetadata(); err != nil {
+		return nil, err
+	}
+	// removed apps may share icon too, delete once
+	deleted := map[string]bool{}
+	for _, app := range removed {
+		name := app.IconStorageName()
+		if name == "" || shared[name] || deleted[name] || !listed[filepath.ToSlash(name)] {
+			continue
+		}
+		deleted[name] = true
+		if err := s.store.Delete(name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return result, firstErr
+}
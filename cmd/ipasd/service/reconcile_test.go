@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+func TestReconcile(t *testing.T) {
+	s := newTestService()
+	a := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	b := testAddAppFiles(t, s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+	if err := s.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+
+	// package lost, orphan package left by crash, stale and fresh temp files
+	if err := s.store.Delete(b.PackageStorageName()); err != nil {
+		t.Fatal(err)
+	}
+	orphan := filepath.Join("com.ineva.c", "cccccccccccccccccccccc.ipa")
+	staleTemp := filepath.Join(tempDir, fmt.Sprintf("%d_x", time.Now().Add(-2*time.Hour).Unix()))
+	freshTemp := tempStorageName()
+	// wrapped key listed by unwrapped storager
+	key := filepath.Join(storager.EncryptKeyDir, "com.ineva.c", "cccccccccccccccccccccc.ipa")
+	for _, name := range []string{orphan, staleTemp, freshTemp, "other/readme.txt", key} {
+		if err := s.store.Save(name, bytes.NewBufferString(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := s.Reconcile(false, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Orphans) != 1 || result.Orphans[0] != orphan {
+		t.Fatalf("orphans not match: %+v", result)
+	}
+	if len(result.StaleTemps) != 1 || result.StaleTemps[0] != staleTemp {
+		t.Fatalf("stale temps not match: %+v", result)
+	}
+	if len(result.Dangling) != 1 || result.Dangling[0] != b.ID {
+		t.Fatalf("dangling not match: %+v", result)
+	}
+	if len(s.list) != 2 {
+		t.Fatal("dry run should not change metadata")
+	}
+
+	if _, err := s.Reconcile(true, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.find(b.ID); err != ErrIdNotFound {
+		t.Fatal("dangling app not removed")
+	}
+	if _, err := s.find(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	names, err := s.store.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+	}
+	if exists[orphan] || exists[staleTemp] || exists[b.IconStorageName()] {
+		t.Fatalf("files not deleted: %v", names)
+	}
+	if !exists[freshTemp] || !exists["other/readme.txt"] || !exists[a.PackageStorageName()] || !exists[key] {
+		t.Fatalf("files should be kept: %v", names)
+	}
+
+	result, err = s.Reconcile(false, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Orphans)+len(result.StaleTemps)+len(result.Dangling) != 0 {
+		t.Fatalf("nothing to reconcile: %+v", result)
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrRetentionRuleInvalid = errors.New("retention rule invalid")
+)
+
+const (
+	// reason of pruned apps
+	PruneReasonKeep   = "keep"
+	PruneReasonAge    = "age"
+	PruneReasonBudget = "budget"
+)
+
+// RetentionRule which builds to keep, builds matched by identifier and channel
+type RetentionRule struct {
+	// glob pattern of identifier and channel, path.Match syntax, empty to match all
+	Identifier string `json:"identifier,omitempty"`
+	Channel    string `json:"channel,omitempty"`
+	// keep the last n builds of each identifier and channel, 0 to keep all
+	Keep int `json:"keep,omitempty"`
+	// delete builds older than it, 0 to keep all
+	MaxAge time.Duration `json:"maxAge,omitempty"`
+}
+
+// ParseRetentionRule parse rule in query format: identifier=com.example.*&channel=beta&keep=10&days=30
+func ParseRetentionRule(s string) (*RetentionRule, error) {
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRetentionRuleInvalid, err)
+	}
+	r := &RetentionRule{}
+	for k, v := range q {
+		switch k {
+		case "identifier":
+			r.Identifier = v[0]
+		case "channel":
+			r.Channel = v[0]
+		case "keep":
+			r.Keep, err = strconv.Atoi(v[0])
+		case "days":
+			var days int
+			days, err = strconv.Atoi(v[0])
+			r.MaxAge = time.Duration(days) * 24 * time.Hour
+		default:
+			return nil, fmt.Errorf("%w: unknown option %s", ErrRetentionRuleInvalid, k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %v", ErrRetentionRuleInvalid, k, err)
+		}
+	}
+	for _, p := range []string{r.Identifier, r.Channel} {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%w: pattern %s", ErrRetentionRuleInvalid, p)
+		}
+	}
+	if r.Keep < 0 || r.MaxAge < 0 || (r.Keep == 0 && r.MaxAge == 0) {
+		return nil, fmt.Errorf("%w: keep or days required", ErrRetentionRuleInvalid)
+	}
+	return r, nil
+}
+
+func (r *RetentionRule) match(app *AppInfo) bool {
+	return globMatch(r.Identifier, app.Identifier) && globMatch(r.Channel, app.Channel)
+}
+
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// RetentionPolicy rules applied by Prune, the first matched rule of each build is used
+type RetentionPolicy struct {
+	Rules []*RetentionRule `json:"rules"`
+	// total size of packages, oldest builds are deleted first when exceeded, 0 to disable
+	Budget int64 `json:"budget"`
+}
+
+func (p *RetentionPolicy) Enabled() bool {
+	return p != nil && (len(p.Rules) > 0 || p.Budget > 0)
+}
+
+func (p *RetentionPolicy) rule(app *AppInfo) (int, *RetentionRule) {
+	for i, r := range p.Rules {
+		if r.match(app) {
+			return i, r
+		}
+	}
+	return -1, nil
+}
+
+// PrunedApp app deleted by Prune
+type PrunedApp struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Identifier string    `json:"identifier"`
+	Version    string    `json:"version"`
+	Build      string    `json:"build"`
+	Channel    string    `json:"channel"`
+	Date       time.Time `json:"date"`
+	Size       int64     `json:"size"`
+	// keep, age or budget
+	Reason string `json:"reason"`
+	// purged from trash to keep under budget, otherwise moved to trash
+	Purged bool `json:"purged"`
+}
+
+// PruneResult apps deleted by Prune, or to be deleted in dry run
+type PruneResult struct {
+	Pruned []*PrunedApp `json:"pruned"`
+	// total size of packages before pruning, packages of apps in trash included
+	TotalSize int64 `json:"totalSize"`
+	// size of packages purged from storage after pruning
+	FreedSize int64 `json:"freedSize"`
+	DryRun    bool  `json:"dryRun"`
+}
+
+// Prune delete builds not kept by retention rules with Delete, purge builds to keep under budget,
+// pinned and locked builds are never pruned
+func (s *service) Prune(dryRun bool) (*PruneResult, error) {
+	result := &PruneResult{Pruned: []*PrunedApp{}, DryRun: dryRun}
+	if !s.retention.Enabled() {
+		return result, nil
+	}
+
+	s.lock.RLock()
+	list := append(AppList{}, s.list...)
+	s.lock.RUnlock()
+	// newest first
+	sort.Stable(list)
+
+	// apps reference each package, alias apps share package, packages of apps in trash still stored
+	refs := map[string]int{}
+	for _, app := range list {
+		name := app.PackageStorageName()
+		if refs[name] == 0 {
+			result.TotalSize += app.Size
+		}
+		refs[name]++
+	}
+	pruned := map[string]*PrunedApp{}
+	prune := func(app *AppInfo, reason string) *PrunedApp {
+		p := &PrunedApp{
+			ID:         app.ID,
+			Name:       app.Name,
+			Identifier: app.Identifier,
+			Version:    app.Version,
+			Build:      app.Build,
+			Channel:    app.Channel,
+			Date:       app.Date,
+			Size:       app.Size,
+			Reason:     reason,
+		}
+		pruned[app.ID] = p
+		result.Pruned = append(result.Pruned, p)
+		return p
+	}
+	purge := func(app *AppInfo) {
+		p := pruned[app.ID]
+		if p == nil {
+			p = prune(app, PruneReasonBudget)
+		}
+		p.Purged = true
+		name := app.PackageStorageName()
+		refs[name]--
+		if refs[name] == 0 {
+			result.FreedSize += app.Size
+		}
+	}
+
+	// builds of each rule, identifier and channel
+	count := map[string]int{}
+	now := time.Now()
+	for _, app := range list {
+		// already deleted
+		if app.Pinned || app.Locked || app.Trashed() {
+			continue
+		}
+		i, r := s.retention.rule(app)
+		if r == nil {
+			continue
+		}
+		key := fmt.Sprintf("%d/%s/%s", i, app.Identifier, app.Channel)
+		n := count[key]
+		count[key]++
+		if r.Keep > 0 && n >= r.Keep {
+			prune(app, PruneReasonKeep)
+		} else if r.MaxAge > 0 && now.Sub(app.Date) > r.MaxAge {
+			prune(app, PruneReasonAge)
+		}
+	}
+
+	// purge oldest builds until under budget, builds in trash first
+	if s.retention.Budget > 0 {
+		for _, trashed := range []bool{true, false} {
+			for i := len(list) - 1; i >= 0 && result.TotalSize-result.FreedSize > s.retention.Budget; i-- {
+				app := list[i]
+				if app.Trashed() != trashed || app.Pinned || app.Locked {
+					continue
+				}
+				purge(app)
+			}
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	var firstErr error
+	for _, p := range result.Pruned {
+		err := s.Delete(p.ID)
+		// apps already in trash purged directly
+		if p.Purged && (err == nil || err == ErrIdNotFound) {
+			err = s.Purge(p.ID)
+		}
+		// NOTE: ignore apps deleted, purged or locked since
+		if err != nil && err != ErrIdNotFound && err != ErrNotTrashed && err != ErrAppLocked && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return result, firstErr
+}
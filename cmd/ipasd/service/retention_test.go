@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseRetentionRule(t *testing.T) {
+	r, err := ParseRetentionRule("identifier=com.ineva.*&channel=beta&keep=10&days=30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Identifier != "com.ineva.*" || r.Channel != "beta" || r.Keep != 10 || r.MaxAge != 30*24*time.Hour {
+		t.Fatalf("rule not match: %+v", r)
+	}
+	for _, s := range []string{"", "identifier=a", "keep=a", "days=-1", "foo=1", "identifier=[&keep=1"} {
+		if _, err := ParseRetentionRule(s); !errors.Is(err, ErrRetentionRuleInvalid) {
+			t.Fatalf("%q: want ErrRetentionRuleInvalid got %v", s, err)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := newTestService(WithRetentionPolicy(&RetentionPolicy{
+		Rules: []*RetentionRule{
+			{Identifier: "com.ineva.a", Keep: 2},
+			{Identifier: "com.ineva.*", MaxAge: 24 * time.Hour},
+		},
+		Budget: 50,
+	}))
+	now := time.Now()
+	add := func(id, identifier string, age time.Duration) *AppInfo {
+		app := testAddAppFiles(t, s, id, identifier)
+		app.Date = now.Add(-age)
+		app.Size = 10
+		return app
+	}
+	// oldest first
+	a1 := add("aaaaaaaaaaaaaaaaaaaaa1", "com.ineva.a", 4*time.Hour)
+	a2 := add("aaaaaaaaaaaaaaaaaaaaa2", "com.ineva.a", 3*time.Hour)
+	a2.Pinned = true
+	add("aaaaaaaaaaaaaaaaaaaaa3", "com.ineva.a", 2*time.Hour)
+	add("aaaaaaaaaaaaaaaaaaaaa4", "com.ineva.a", time.Hour)
+	b1 := add("bbbbbbbbbbbbbbbbbbbbb1", "com.ineva.b", 48*time.Hour)
+	c1 := add("ccccccccccccccccccccc1", "other.c", 72*time.Hour)
+	add("ccccccccccccccccccccc2", "other.c", 10*time.Minute)
+
+	result, err := s.Prune(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ""
+	for _, p := range result.Pruned {
+		got += fmt.Sprintf("%s:%s:%v ", p.ID, p.Reason, p.Purged)
+	}
+	// a1 beyond last 2 unpinned builds, b1 too old, c1 and b1 oldest over budget
+	want := fmt.Sprintf("%s:keep:false %s:age:true %s:budget:true ", a1.ID, b1.ID, c1.ID)
+	if got != want {
+		t.Fatalf("want %s got %s", want, got)
+	}
+	if result.TotalSize != 70 || result.FreedSize != 20 {
+		t.Fatalf("size not match: %+v", result)
+	}
+	if len(s.list) != 7 {
+		t.Fatal("dry run should not delete apps")
+	}
+
+	if _, err := s.Prune(false); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := s.Trash("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != a1.ID {
+		t.Fatalf("apps not pruned to trash, %d trashed", len(trash))
+	}
+	if len(s.list) != 5 {
+		t.Fatalf("apps over budget not purged, %d apps", len(s.list))
+	}
+	if _, err := s.find(a2.ID); err != nil {
+		t.Fatal("pinned app pruned")
+	}
+	// trashed apps not pruned again
+	if result, err := s.Prune(true); err != nil || len(result.Pruned) != 0 {
+		t.Fatalf("nothing to prune: %+v %v", result, err)
+	}
+
+	// packages in trash count toward budget and purged first
+	s.retention.Budget = 40
+	if _, err := s.Prune(false); err != nil {
+		t.Fatal(err)
+	}
+	if trash, err := s.Trash(""); err != nil || len(trash) != 0 {
+		t.Fatalf("app in trash not purged: %v", err)
+	}
+	if len(s.list) != 4 {
+		t.Fatalf("want 4 apps got %d", len(s.list))
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrScheduleInvalid = errors.New("expireAt must be after publishAt")
+)
+
+const (
+	// build becomes visible at PublishAt
+	EventPublished = "published"
+	// build hidden at ExpireAt
+	EventExpired = "expired"
+)
+
+// ScheduleEvent build published or expired
+type ScheduleEvent struct {
+	Event      string    `json:"event"`
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Identifier string    `json:"identifier"`
+	Version    string    `json:"version"`
+	Build      string    `json:"build"`
+	Channel    string    `json:"channel"`
+	Date       time.Time `json:"date"`
+}
+
+// ParseScheduleTime parse RFC3339 time, nil for empty string
+func ParseScheduleTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("time invalid, RFC3339 only: %w", err)
+	}
+	return &t, nil
+}
+
+// ParseAddOptions options of upload from form values: notes, publishAt, expireAt
+func ParseAddOptions(value func(key string) string) (*AddOptions, error) {
+	opts := &AddOptions{Notes: value("notes")}
+	var err error
+	if opts.PublishAt, err = ParseScheduleTime(value("publishAt")); err != nil {
+		return nil, err
+	}
+	if opts.ExpireAt, err = ParseScheduleTime(value("expireAt")); err != nil {
+		return nil, err
+	}
+	if err := checkSchedule(opts.PublishAt, opts.ExpireAt); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func checkSchedule(publishAt, expireAt *time.Time) error {
+	if publishAt != nil && expireAt != nil && !expireAt.After(*publishAt) {
+		return ErrScheduleInvalid
+	}
+	return nil
+}
+
+// Visible app published and not expired at now
+func (a *AppInfo) Visible(now time.Time) bool {
+	if a.PublishAt != nil && now.Before(*a.PublishAt) {
+		return false
+	}
+	if a.ExpireAt != nil && !now.Before(*a.ExpireAt) {
+		return false
+	}
+	return true
+}
+
+// Scheduled apps not published yet or expired, hidden from list, publish time first
+func (s *service) Scheduled(publicURL string) ([]*Item, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	now := time.Now()
+	list := []*Item{}
+	for _, row := range s.list {
+		if !row.Trashed() && !row.Visible(now) {
+			list = append(list, s.itemInfo(row, publicURL))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].PublishAt, list[j].PublishAt
+		return a != nil && (b == nil || a.Before(*b))
+	})
+	return list, nil
+}
+
+// Schedule events of apps published or expired and not marked notified, oldest first
+func (s *service) Schedule() ([]*ScheduleEvent, error) {
+	events := []*ScheduleEvent{}
+	now := time.Now()
+	s.lock.RLock()
+	for _, app := range s.list {
+		if app.Trashed() {
+			continue
+		}
+		if app.PublishAt != nil && !now.Before(*app.PublishAt) && !hasTag(app.Notified, EventPublished) {
+			events = append(events, newScheduleEvent(app, EventPublished, *app.PublishAt))
+		}
+		if app.ExpireAt != nil && !now.Before(*app.ExpireAt) && !hasTag(app.Notified, EventExpired) {
+			events = append(events, newScheduleEvent(app, EventExpired, *app.ExpireAt))
+		}
+	}
+	s.lock.RUnlock()
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date.Before(events[j].Date) })
+	return events, nil
+}
+
+// MarkNotified mark event of app delivered, not returned by Schedule again
+func (s *service) MarkNotified(id, event string) error {
+	s.lock.Lock()
+	app, err := s.find(id)
+	if err == nil && !hasTag(app.Notified, event) {
+		app.Notified = append(app.Notified, event)
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.saveMetadataAuto()
+}
+
+func newScheduleEvent(app *AppInfo, event string, date time.Time) *ScheduleEvent {
+	return &ScheduleEvent{
+		Event:      event,
+		ID:         app.ID,
+		Name:       app.Name,
+		Identifier: app.Identifier,
+		Version:    app.Version,
+		Build:      app.Build,
+		Channel:    app.Channel,
+		Date:       date,
+	}
+}
+
+// PackageVisible false if package only belongs to apps in trash, not published yet or expired
+func (s *service) PackageVisible(name string) bool {
+	name = strings.TrimPrefix(name, "/")
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	now := time.Now()
+	found := false
+	for _, row := range s.list {
+		if row.PackageStorageName() != name {
+			continue
+		}
+		if !row.Trashed() && row.Visible(now) {
+			return true
+		}
+		found = true
+	}
+	return !found
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	s := newTestService()
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	a := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	a.Date = past
+	b := testAddAppFiles(t, s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.a")
+	b.PublishAt = &future
+
+	// scheduled build hidden from list, info, plist, latest and package serving
+	d, err := s.List("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := d["list"].([]*Item)
+	if len(list) != 1 || list[0].ID != a.ID || len(list[0].History) != 1 {
+		t.Fatalf("scheduled build listed: %+v", list)
+	}
+	if _, err := s.Find(b.ID, ""); err != ErrIdNotFound {
+		t.Fatalf("want ErrIdNotFound got %v", err)
+	}
+	if _, err := s.Plist(b.ID, ""); err != ErrIdNotFound {
+		t.Fatalf("want ErrIdNotFound got %v", err)
+	}
+	if item, err := s.Latest("com.ineva.a", "", AppInfoTypeUnknown, ""); err != nil || item.ID != a.ID {
+		t.Fatalf("latest not match: %v %v", item, err)
+	}
+	if s.PackageVisible("/"+b.PackageStorageName()) || !s.PackageVisible(a.PackageStorageName()) || !s.PackageVisible("other.ipa") {
+		t.Fatal("package visible not match")
+	}
+	if scheduled, err := s.Scheduled(""); err != nil || len(scheduled) != 1 || scheduled[0].ID != b.ID {
+		t.Fatalf("scheduled not match: %v %v", scheduled, err)
+	}
+
+	// publish now and expire a
+	empty, expire := "", past.Format(time.RFC3339)
+	if err := s.Edit(b.ID, &AppPatch{PublishAt: &empty}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Edit(a.ID, &AppPatch{ExpireAt: &expire}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(b.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(a.ID, ""); err != ErrIdNotFound {
+		t.Fatal("expired build found")
+	}
+	before := now.Add(-2 * time.Hour).Format(time.RFC3339)
+	if err := s.Edit(a.ID, &AppPatch{PublishAt: &expire, ExpireAt: &before}); err != ErrScheduleInvalid {
+		t.Fatalf("want ErrScheduleInvalid got %v", err)
+	}
+
+	// events returned until marked notified
+	for i := 0; i < 2; i++ {
+		events, err := s.Schedule()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Event != EventExpired || events[0].ID != a.ID {
+			t.Fatalf("events not match: %+v", events)
+		}
+	}
+	if err := s.MarkNotified(a.ID, EventExpired); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := s.Schedule(); len(events) != 0 {
+		t.Fatalf("events sent again: %+v", events)
+	}
+	b.PublishAt = &past
+	if events, _ := s.Schedule(); len(events) != 1 || events[0].Event != EventPublished || events[0].ID != b.ID {
+		t.Fatalf("published event not match: %+v", events)
+	}
+}
+
+func TestParseAddOptions(t *testing.T) {
+	values := map[string]string{"notes": "n", "publishAt": "2030-01-01T00:00:00Z", "expireAt": "2030-02-01T00:00:00Z"}
+	opts, err := ParseAddOptions(func(k string) string { return values[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Notes != "n" || opts.PublishAt.Year() != 2030 || opts.ExpireAt.Month() != time.February {
+		t.Fatalf("options not match: %+v", opts)
+	}
+	values["expireAt"] = "2029-01-01T00:00:00Z"
+	if _, err := ParseAddOptions(func(k string) string { return values[k] }); err != ErrScheduleInvalid {
+		t.Fatalf("want ErrScheduleInvalid got %v", err)
+	}
+	values["expireAt"] = "tomorrow"
+	if _, err := ParseAddOptions(func(k string) string { return values[k] }); err == nil {
+		t.Fatal("invalid time parsed")
+	}
+}
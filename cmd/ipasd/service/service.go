@@ -19,17 +19,22 @@ import (
 	"github.com/iineva/ipa-server/pkg/apk"
 	"github.com/iineva/ipa-server/pkg/ipa"
 	"github.com/iineva/ipa-server/pkg/storager"
-	"github.com/iineva/ipa-server/pkg/uuid"
 )
 
 var (
 	ErrIdNotFound = errors.New("id not found")
+	ErrAppLocked  = errors.New("app is locked, unlock it before delete")
 )
 
 const (
 	tempDir = ".ipa_parser_temp"
 )
 
+// PrivateDirs storage dirs which should never be served to public
+func PrivateDirs() []string {
+	return []string{tempDir, snapshotDir}
+}
+
 // Item to use on web interface
 type Item struct {
 	// from AppInfo
@@ -55,6 +60,22 @@ type Item struct {
 	WebIcon string `json:"webIcon"`
 	// Type 0:ios 1:android
 	Type AppInfoType `json:"type"`
+	// hex checksums of package
+	SHA256 string `json:"sha256,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+	// package checksum not match
+	Corrupted bool     `json:"corrupted,omitempty"`
+	Pinned    bool     `json:"pinned,omitempty"`
+	Locked    bool     `json:"locked,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Tracks    []string `json:"tracks,omitempty"`
+	// moved to trash at
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	ExpireAt  *time.Time `json:"expireAt,omitempty"`
+	// release notes in Markdown, and rendered sanitized HTML
+	Notes     string `json:"notes,omitempty"`
+	NotesHTML string `json:"notesHtml,omitempty"`
 
 	Current bool    `json:"current"`
 	History []*Item `json:"history,omitempty"`
@@ -69,8 +90,34 @@ type Service interface {
 	Find(id string, publicURL string) (*Item, error)
 	History(id string, publicURL string) ([]*Item, error)
 	Delete(id string) error
-	Add(r Reader, size int64, t AppInfoType) (*AppInfo, error)
+	Add(r Reader, size int64, t AppInfoType, opts *AddOptions) (*AppInfo, error)
 	Plist(id, publicURL string) ([]byte, error)
+	Snapshots() ([]*Snapshot, error)
+	DiffSnapshot(id string) (*SnapshotDiff, error)
+	RestoreSnapshot(id string) error
+	StorageNames() []string
+	Export(w io.Writer, format ArchiveFormat) error
+	Import(r io.Reader, format ArchiveFormat) (*ImportResult, error)
+	FindByStorageName(name string) (*AppInfo, error)
+	Verify() (*VerifyResult, error)
+	Reconcile(fix bool, tempAge time.Duration) (*ReconcileResult, error)
+	Prune(dryRun bool) (*PruneResult, error)
+	SetPinned(id string, pinned bool) error
+	SetLocked(id string, locked bool) error
+	Trash(publicURL string) ([]*Item, error)
+	Restore(id string) error
+	Purge(id string) error
+	PurgeTrash() ([]string, error)
+	Batch(r *BatchRequest) (*BatchResult, error)
+	Edit(id string, p *AppPatch) error
+	Promote(id, track, actor string) error
+	Tracks(identifier, publicURL string) (*TrackInfo, error)
+	FindTrack(identifier, track, publicURL string) (*Item, error)
+	Latest(identifier, channel string, t AppInfoType, publicURL string) (*Item, error)
+	Scheduled(publicURL string) ([]*Item, error)
+	Schedule() ([]*ScheduleEvent, error)
+	MarkNotified(id, event string) error
+	PackageVisible(name string) bool
 }
 
 type Reader interface {
@@ -84,14 +131,36 @@ type service struct {
 	store        storager.Storager
 	publicURL    string
 	metadataName string
+
+	snapshotLock      sync.Mutex
+	snapshotRetention int
+
+	dedupPolicy     DedupPolicy
+	duplicatePolicy DuplicatePolicy
+	// reject apk with versionCode lower than the latest apk
+	strictVersionCode bool
+	ordering          Ordering
+	retention         *RetentionPolicy
+	// keep trashed apps before purged, 0 to keep forever
+	trashRetention time.Duration
+
+	// storage names of files being saved, guarded by lock
+	pending map[string]bool
 }
 
-func New(store storager.Storager, publicURL, metadataName string) Service {
+func New(store storager.Storager, publicURL, metadataName string, opts ...Option) Service {
 	s := &service{
-		store:        store,
-		list:         AppList{},
-		publicURL:    publicURL, // use set public url
-		metadataName: metadataName,
+		store:           store,
+		list:            AppList{},
+		publicURL:       publicURL, // use set public url
+		metadataName:    metadataName,
+		dedupPolicy:     DedupOff,
+		ordering:        OrderDate,
+		duplicatePolicy: DuplicateAllow,
+		pending:         map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	if err := s.tryMigrateOldData(); err != nil {
 		// NOTE: ignore error
@@ -103,7 +172,12 @@ func (s *service) List(publicURL string, uploadDisabled bool) (map[string]interf
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	list := []*Item{}
-	for _, row := range s.list {
+	// the first build of each identifier is the current one
+	now := time.Now()
+	for _, row := range s.sorted() {
+		if row.Trashed() || !row.Visible(now) {
+			continue
+		}
 		has := false
 		for _, i := range list {
 			if i.Identifier == row.Identifier {
@@ -127,7 +201,7 @@ func (s *service) List(publicURL string, uploadDisabled bool) (map[string]interf
 func (s *service) Find(id string, publicURL string) (*Item, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
-	app, err := s.find(id)
+	app, err := s.findVisible(id)
 	if err != nil {
 		return nil, err
 	}
@@ -140,69 +214,120 @@ func (s *service) Find(id string, publicURL string) (*Item, error) {
 func (s *service) History(id string, publicURL string) ([]*Item, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
-	app, err := s.find(id)
+	app, err := s.findVisible(id)
 	if err != nil {
 		return nil, err
 	}
 	return s.history(app, publicURL), nil
 }
 
+// Delete move app to trash, files are kept until purged, locked app can not be deleted
 func (s *service) Delete(id string) error {
 	s.lock.Lock()
-	var app *AppInfo
-	for i, a := range s.list {
-		if a.ID == id {
-			app = a
-			s.list = append(s.list[:i], s.list[i+1:]...)
-			break
-		}
+	app, err := s.find(id)
+	if err == nil && app.Locked {
+		err = ErrAppLocked
+	}
+	if err == nil {
+		now := time.Now()
+		app.DeletedAt = &now
 	}
 	s.lock.Unlock()
-
-	if app == nil {
-		return ErrIdNotFound
+	if err != nil {
+		return err
 	}
+	return s.saveMetadata()
+}
 
-	if err := s.saveMetadata(); err != nil {
-		return err
+// StorageNames names of metadata, snapshots, packages and icons saved in storager
+func (s *service) StorageNames() []string {
+	s.lock.RLock()
+	names := []string{s.metadataName}
+	seen := map[string]bool{}
+	for _, app := range s.list {
+		for _, name := range app.StorageNames() {
+			// alias apps share files
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
 	}
+	s.lock.RUnlock()
 
-	if err := s.store.Delete(app.PackageStorageName()); err != nil {
-		return err
+	snaps, err := s.snapshots()
+	if err != nil || len(snaps) == 0 {
+		return names
 	}
-	if !app.NoneIcon {
-		if err := s.store.Delete(app.IconStorageName()); err != nil {
-			return err
-		}
+	names = append(names, s.snapshotStorageName(snapshotIndexName))
+	for _, snap := range snaps {
+		names = append(names, s.snapshotStorageName(snap.ID+".json"))
 	}
-	return nil
+	return names
 }
 
-func (s *service) Add(r Reader, size int64, t AppInfoType) (*AppInfo, error) {
+// AddOptions optional fields of uploaded app
+type AddOptions struct {
+	// release notes in Markdown
+	Notes string
+	// hidden before PublishAt and since ExpireAt
+	PublishAt *time.Time
+	ExpireAt  *time.Time
+}
+
+func (s *service) Add(r Reader, size int64, t AppInfoType, opts *AddOptions) (*AppInfo, error) {
 
-	app, err := s.addPackage(r, size, t)
+	app, isNew, err := s.addPackage(r, size, t)
 	if err != nil {
 		return nil, err
 	}
+	if !isNew {
+		return app, nil
+	}
+	defer s.setPending(false, app.StorageNames()...)
+	if opts != nil {
+		app.Notes, app.PublishAt, app.ExpireAt = opts.Notes, opts.PublishAt, opts.ExpireAt
+	}
 
 	// update list
 	s.lock.Lock()
+	replaced := s.replace(app)
 	s.list = append([]*AppInfo{app}, s.list...)
+	// files of replaced app no longer referenced
+	unused := []string{}
+	if replaced != nil {
+		for _, name := range replaced.StorageNames() {
+			if s.storageRefs(name) == 0 {
+				unused = append(unused, name)
+			}
+		}
+	}
 	s.lock.Unlock()
 
-	return app, s.saveMetadata()
+	if err := s.saveMetadata(); err != nil {
+		return app, err
+	}
+	for _, name := range unused {
+		if err := s.store.Delete(name); err != nil {
+			// NOTE: ignore error, orphan files removed by reconcile
+		}
+	}
+	return app, nil
 }
 
-func (s *service) addPackage(r Reader, size int64, t AppInfoType) (*AppInfo, error) {
-	// save ipa file to temp
-	pkgTempFileName := filepath.Join(tempDir, uuid.NewString())
-	if err := s.store.Save(pkgTempFileName, r); err != nil {
-		return nil, err
+// isNew is false if existing app returned by DedupExisting
+func (s *service) addPackage(r Reader, size int64, t AppInfoType) (app *AppInfo, isNew bool, err error) {
+	// save ipa file to temp, compute checksums while streaming
+	pkgTempFileName := tempStorageName()
+	s.setPending(true, pkgTempFileName)
+	defer s.setPending(false, pkgTempFileName)
+	h := newPackageHash()
+	if err := s.store.Save(pkgTempFileName, io.TeeReader(r, h)); err != nil {
+		return nil, false, err
 	}
 
 	// parse package
 	var pkg Package
-	var err error
 	switch t {
 	case AppInfoTypeIpa:
 		pkg, err = ipa.Parse(r, size)
@@ -210,15 +335,49 @@ func (s *service) addPackage(r Reader, size int64, t AppInfoType) (*AppInfo, err
 		pkg, err = apk.Parse(r, size)
 	}
 	if err != nil {
-		return nil, err
+		if err := s.store.Delete(pkgTempFileName); err != nil {
+			// NOTE: ignore error, stale temp file removed by reconcile
+		}
+		return nil, false, err
 	}
 
 	// new AppInfo
-	app := NewAppInfo(pkg, t)
-	// move temp package file to target location
+	app = NewAppInfo(pkg, t)
+	app.SHA256, app.SHA1 = h.SHA256(), h.SHA1()
+
+	// duplicate policy applies to alias and existing apps too
+	if err := s.checkBuild(app); err != nil {
+		if err := s.store.Delete(pkgTempFileName); err != nil {
+			// NOTE: ignore error
+		}
+		return nil, false, err
+	}
+
+	if s.dedupPolicy != DedupOff {
+		s.lock.RLock()
+		dup := s.findDuplicate(app)
+		s.lock.RUnlock()
+		if dup != nil {
+			if err := s.store.Delete(pkgTempFileName); err != nil {
+				// NOTE: ignore error
+			}
+			if s.dedupPolicy == DedupExisting {
+				return dup, false, nil
+			}
+			// alias share package and icon with existing app
+			app.StorageName = dup.PackageStorageName()
+			app.NoneIcon = dup.NoneIcon
+			app.IconName = dup.IconStorageName()
+			return app, true, nil
+		}
+	}
+
+	// move temp package file to target location, files pending until saved to metadata
+	s.setPending(true, app.StorageNames()...)
 	err = s.store.Move(pkgTempFileName, app.PackageStorageName())
 	if err != nil {
-		return nil, err
+		s.setPending(false, app.StorageNames()...)
+		return nil, false, err
 	}
 
 	// try save icon file
@@ -232,13 +391,23 @@ func (s *service) addPackage(r Reader, size int64, t AppInfoType) (*AppInfo, err
 		}
 	}
 
-	return app, nil
+	return app, true, nil
 }
 
-// save metadata
+// save metadata and take snapshot
 func (s *service) saveMetadata() error {
+	return s.writeMetadata(true)
+}
+
+// save metadata changed by background jobs, no snapshot taken to keep restore points of user changes
+func (s *service) saveMetadataAuto() error {
+	return s.writeMetadata(false)
+}
+
+func (s *service) writeMetadata(snapshot bool) error {
 	s.lock.Lock()
 	d, err := json.Marshal(s.list)
+	count := len(s.list)
 	s.lock.Unlock()
 
 	if err != nil {
@@ -246,7 +415,31 @@ func (s *service) saveMetadata() error {
 	}
 
 	b := bytes.NewBuffer(d)
-	return s.store.Save(s.metadataName, b)
+	if err := s.store.Save(s.metadataName, b); err != nil {
+		return err
+	}
+
+	if !snapshot {
+		return nil
+	}
+	// NOTE: ignore error, metadata already saved
+	_ = s.saveSnapshot(d, count)
+	return nil
+}
+
+// file saved in storage, to tell missing file from other errors of OpenMetadata
+func (s *service) storageExists(name string) (bool, error) {
+	name = filepath.ToSlash(name)
+	list, err := s.store.List(name)
+	if err != nil {
+		return false, err
+	}
+	for _, n := range list {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func (s *service) tryMigrateOldData() error {
@@ -281,15 +474,28 @@ func (s *service) Plist(id, publicURL string) ([]byte, error) {
 	return NewInstallPlist(app)
 }
 
+// find app not trashed
 func (s *service) find(id string) (*AppInfo, error) {
 	for _, row := range s.list {
-		if row.ID == id {
+		if row.ID == id && !row.Trashed() {
 			return row, nil
 		}
 	}
 	return nil, ErrIdNotFound
 }
 
+// find app not trashed, published and not expired
+func (s *service) findVisible(id string) (*AppInfo, error) {
+	app, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if !app.Visible(time.Now()) {
+		return nil, ErrIdNotFound
+	}
+	return app, nil
+}
+
 // get public url
 func (s *service) storagerPublicURL(publicURL, name string) string {
 	if s.publicURL != "" {
@@ -332,10 +538,15 @@ func (s *service) itemInfo(row *AppInfo, publicURL string) *Item {
 		}
 	}
 
+	name := row.Name
+	if row.DisplayName != "" {
+		name = row.DisplayName
+	}
+
 	return &Item{
 		// from AppInfo
 		ID:         row.ID,
-		Name:       row.Name,
+		Name:       name,
 		Date:       row.Date,
 		Size:       row.Size,
 		Build:      row.Build,
@@ -343,6 +554,18 @@ func (s *service) itemInfo(row *AppInfo, publicURL string) *Item {
 		Version:    row.Version,
 		Channel:    row.Channel,
 		Type:       row.Type,
+		SHA256:     row.SHA256,
+		SHA1:       row.SHA1,
+		Corrupted:  row.Corrupted,
+		Pinned:     row.Pinned,
+		Locked:     row.Locked,
+		Tags:       row.Tags,
+		Tracks:     row.Tracks,
+		DeletedAt:  row.DeletedAt,
+		PublishAt:  row.PublishAt,
+		ExpireAt:   row.ExpireAt,
+		Notes:      row.Notes,
+		NotesHTML:  renderNotes(row.Notes),
 
 		MetaData:       row.MetaData,
 		MetaDataFilter: metaDataFilter,
@@ -355,14 +578,22 @@ func (s *service) itemInfo(row *AppInfo, publicURL string) *Item {
 }
 
 func (s *service) history(row *AppInfo, publicURL string) []*Item {
-	list := []*Item{}
+	apps := AppList{}
+	now := time.Now()
 	for _, i := range s.list {
-		if i.Identifier == row.Identifier {
-			item := s.itemInfo(i, publicURL)
-			item.Current = i.ID == row.ID
-			list = append(list, item)
+		if i.Identifier == row.Identifier && !i.Trashed() && i.Visible(now) {
+			apps = append(apps, i)
 		}
 	}
+	s.ordering.sort(apps)
+	list := []*Item{}
+	for _, i := range apps {
+		item := s.itemInfo(i, publicURL)
+		item.Current = i.ID == row.ID
+		list = append(list, item)
+	}
+	// pinned builds at the top
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Pinned && !list[j].Pinned })
 	return list
 }
 
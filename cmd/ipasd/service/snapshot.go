@@ -0,0 +1,243 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrSnapshotInvalid  = errors.New("snapshot id invalid")
+)
+
+const (
+	snapshotDir       = ".ipa_metadata_snapshots"
+	snapshotIndexName = "index.json"
+	snapshotIDLayout  = "20060102T150405.000000000Z"
+)
+
+// Snapshot of metadata list at a point in time
+type Snapshot struct {
+	ID    string    `json:"id"`
+	Date  time.Time `json:"date"`
+	Count int       `json:"count"`
+	// sha256 of metadata, same metadata saved again is not a new snapshot
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// SnapshotDiff compare a snapshot with current metadata list
+type SnapshotDiff struct {
+	Snapshot *Snapshot `json:"snapshot"`
+	// apps only in snapshot, will be added back on restore
+	OnlyInSnapshot []*AppInfo `json:"onlyInSnapshot"`
+	// apps only in current list, will be removed on restore
+	OnlyInCurrent []*AppInfo `json:"onlyInCurrent"`
+	// apps in both but with different metadata
+	Changed []*AppInfo `json:"changed"`
+}
+
+func (s *service) snapshotStorageName(name string) string {
+	// keep snapshots under metadata name, secret metadata path also hide snapshots
+	return filepath.Join(snapshotDir, s.metadataName, name)
+}
+
+func (s *service) snapshots() ([]*Snapshot, error) {
+	name := s.snapshotStorageName(snapshotIndexName)
+	f, err := s.store.OpenMetadata(name)
+	if err != nil {
+		if ok, existsErr := s.storageExists(name); existsErr == nil && !ok {
+			// NOTE: no snapshot yet
+			return []*Snapshot{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	list := []*Snapshot{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *service) saveSnapshots(list []*Snapshot) error {
+	d, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return s.store.Save(s.snapshotStorageName(snapshotIndexName), bytes.NewBuffer(d))
+}
+
+// save metadata as a new snapshot, and rotate old snapshots
+func (s *service) saveSnapshot(d []byte, count int) error {
+	if s.snapshotRetention <= 0 {
+		return nil
+	}
+
+	s.snapshotLock.Lock()
+	defer s.snapshotLock.Unlock()
+
+	list, err := s.snapshots()
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// NOTE: index broken, start a new one
+		list, err = []*Snapshot{}, nil
+	}
+	if err != nil {
+		// keep index of existing snapshots if storage failed to read it
+		return err
+	}
+
+	sum := sha256.Sum256(d)
+	checksum := hex.EncodeToString(sum[:])
+	if len(list) > 0 && list[0].SHA256 == checksum {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	snap := &Snapshot{ID: now.Format(snapshotIDLayout), Date: now, Count: count, SHA256: checksum}
+	if err := s.store.Save(s.snapshotStorageName(snap.ID+".json"), bytes.NewBuffer(d)); err != nil {
+		return err
+	}
+	list = append([]*Snapshot{snap}, list...)
+
+	var expired []*Snapshot
+	if len(list) > s.snapshotRetention {
+		expired = list[s.snapshotRetention:]
+		list = list[:s.snapshotRetention]
+	}
+	if err := s.saveSnapshots(list); err != nil {
+		return err
+	}
+	for _, e := range expired {
+		if err := s.store.Delete(s.snapshotStorageName(e.ID + ".json")); err != nil {
+			// NOTE: ignore error
+		}
+	}
+	return nil
+}
+
+func (s *service) findSnapshot(id string) (*Snapshot, error) {
+	if err := tryMatchSnapshotID(id); err != nil {
+		return nil, err
+	}
+	list, err := s.snapshots()
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range list {
+		if snap.ID == id {
+			return snap, nil
+		}
+	}
+	return nil, ErrSnapshotNotFound
+}
+
+func (s *service) openSnapshot(snap *Snapshot) (AppList, error) {
+	f, err := s.store.OpenMetadata(s.snapshotStorageName(snap.ID + ".json"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	list := AppList{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *service) Snapshots() ([]*Snapshot, error) {
+	s.snapshotLock.Lock()
+	defer s.snapshotLock.Unlock()
+	return s.snapshots()
+}
+
+func (s *service) DiffSnapshot(id string) (*SnapshotDiff, error) {
+	snap, err := s.findSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.openSnapshot(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	current := map[string]*AppInfo{}
+	for _, app := range s.list {
+		current[app.ID] = app
+	}
+	diff := &SnapshotDiff{
+		Snapshot:       snap,
+		OnlyInSnapshot: []*AppInfo{},
+		OnlyInCurrent:  []*AppInfo{},
+		Changed:        []*AppInfo{},
+	}
+	for _, app := range list {
+		c, ok := current[app.ID]
+		if !ok {
+			diff.OnlyInSnapshot = append(diff.OnlyInSnapshot, app)
+			continue
+		}
+		delete(current, app.ID)
+		a, _ := json.Marshal(app)
+		b, _ := json.Marshal(c)
+		if !bytes.Equal(a, b) {
+			diff.Changed = append(diff.Changed, app)
+		}
+	}
+	for _, app := range s.list {
+		if _, ok := current[app.ID]; ok {
+			diff.OnlyInCurrent = append(diff.OnlyInCurrent, app)
+		}
+	}
+	return diff, nil
+}
+
+func (s *service) RestoreSnapshot(id string) error {
+	snap, err := s.findSnapshot(id)
+	if err != nil {
+		return err
+	}
+	list, err := s.openSnapshot(snap)
+	if err != nil {
+		return err
+	}
+	sort.Sort(list)
+
+	s.lock.Lock()
+	s.list = list
+	s.lock.Unlock()
+
+	// NOTE: restore also create a new snapshot, so it can be undone
+	return s.saveMetadata()
+}
+
+func tryMatchSnapshotID(id string) error {
+	const snapshotIDRegexp = `^[0-9]{8}T[0-9]{6}\.[0-9]{9}Z$`
+	match, err := regexp.MatchString(snapshotIDRegexp, id)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrSnapshotInvalid
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+func newTestService(opts ...Option) *service {
+	return New(storager.NewMemStorager(), "https://example.com", "appList.json", opts...).(*service)
+}
+
+func testAddApp(s *service, id, identifier string) *AppInfo {
+	app := &AppInfo{ID: id, Identifier: identifier, Version: "1.0", Build: "1", Date: time.Now()}
+	s.lock.Lock()
+	s.list = append([]*AppInfo{app}, s.list...)
+	s.lock.Unlock()
+	return app
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	s := newTestService(WithSnapshotRetention(2))
+
+	testAddApp(s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	if err := s.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	testAddApp(s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+	if err := s.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	testAddApp(s, "cccccccccccccccccccccc", "com.ineva.c")
+	if err := s.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("want 2 snapshots got %d", len(list))
+	}
+
+	// oldest kept snapshot has 2 apps
+	snap := list[len(list)-1]
+	if snap.Count != 2 {
+		t.Fatalf("want 2 apps in snapshot got %d", snap.Count)
+	}
+	diff, err := s.DiffSnapshot(snap.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.OnlyInCurrent) != 1 || diff.OnlyInCurrent[0].ID != "cccccccccccccccccccccc" {
+		t.Fatalf("diff not match: %+v", diff)
+	}
+	if len(diff.OnlyInSnapshot) != 0 || len(diff.Changed) != 0 {
+		t.Fatalf("diff not match: %+v", diff)
+	}
+
+	if err := s.RestoreSnapshot(snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.list) != 2 {
+		t.Fatalf("want 2 apps after restore got %d", len(s.list))
+	}
+
+	// restore is a new snapshot too
+	list, err = s.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Count != 2 {
+		t.Fatalf("restore snapshot not found: %+v", list)
+	}
+}
+
+func TestSnapshotDisabled(t *testing.T) {
+	s := newTestService()
+	testAddApp(s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	if err := s.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("want no snapshot got %d", len(list))
+	}
+}
+
+// storager failed to read files, List still works
+type unreadableStorager struct {
+	storager.Storager
+	unreadable bool
+}
+
+func (u *unreadableStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	if u.unreadable {
+		return nil, errors.New("read failed")
+	}
+	return u.Storager.OpenMetadata(name)
+}
+
+func TestSnapshotIndexUnreadable(t *testing.T) {
+	store := &unreadableStorager{Storager: storager.NewMemStorager()}
+	s := New(store, "https://example.com", "appList.json", WithSnapshotRetention(2)).(*service)
+
+	// index not found is empty list
+	if list, err := s.Snapshots(); err != nil || len(list) != 0 {
+		t.Fatalf("want empty list got %v %v", list, err)
+	}
+	testAddApp(s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	if err := s.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+
+	// index kept if storage failed to read it
+	store.unreadable = true
+	if _, err := s.Snapshots(); err == nil {
+		t.Fatal("want read error")
+	}
+	testAddApp(s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+	if err := s.saveMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	store.unreadable = false
+	if list, err := s.Snapshots(); err != nil || len(list) != 1 {
+		t.Fatalf("index overwritten: %v %v", list, err)
+	}
+}
+
+func TestSnapshotSkipped(t *testing.T) {
+	s := newTestService(WithSnapshotRetention(10))
+	a := testAddApp(s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	for i := 0; i < 3; i++ {
+		if err := s.saveMetadata(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// background jobs take no snapshot
+	if err := s.MarkNotified(a.ID, EventPublished); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("want 1 snapshot got %d", len(list))
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var (
+	ErrTrackInvalid  = errors.New("track invalid")
+	ErrTrackNotFound = errors.New("track not found")
+)
+
+// Promotion build promoted to track
+type Promotion struct {
+	ID         string    `json:"id"`
+	Identifier string    `json:"identifier"`
+	Track      string    `json:"track"`
+	Actor      string    `json:"actor,omitempty"`
+	Date       time.Time `json:"date"`
+}
+
+// TrackInfo builds promoted to each track of identifier
+type TrackInfo struct {
+	Identifier string           `json:"identifier"`
+	Tracks     map[string]*Item `json:"tracks"`
+	// newest first
+	History []*Promotion `json:"history"`
+}
+
+var trackRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidTrack check track name: dev, beta, production, lower case letters, digits, - and _
+func ValidTrack(track string) error {
+	if !trackRegexp.MatchString(track) {
+		return ErrTrackInvalid
+	}
+	return nil
+}
+
+// Promote set app as the build of track, replace build promoted to track before
+func (s *service) Promote(id, track, actor string) error {
+	if err := ValidTrack(track); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	app, err := s.find(id)
+	if err == nil {
+		s.promote(app, track, actor)
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.saveMetadata()
+}
+
+// promote app to track, lock must be held
+func (s *service) promote(app *AppInfo, track, actor string) {
+	for _, row := range s.list {
+		if row.Identifier == app.Identifier && hasTag(row.Tracks, track) {
+			row.Tracks = removeTag(row.Tracks, track)
+		}
+	}
+	app.Tracks = append(app.Tracks, track)
+	app.Promotions = append(app.Promotions, &Promotion{
+		ID:         app.ID,
+		Identifier: app.Identifier,
+		Track:      track,
+		Actor:      actor,
+		Date:       time.Now(),
+	})
+}
+
+// Tracks builds promoted to tracks of identifier and promotion history
+func (s *service) Tracks(identifier, publicURL string) (*TrackInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	info := &TrackInfo{Identifier: identifier, Tracks: map[string]*Item{}, History: []*Promotion{}}
+	for _, app := range s.list {
+		if app.Identifier != identifier {
+			continue
+		}
+		// history of trashed builds kept until purged
+		info.History = append(info.History, app.Promotions...)
+		if app.Trashed() {
+			continue
+		}
+		for _, track := range app.Tracks {
+			info.Tracks[track] = s.itemInfo(app, publicURL)
+		}
+	}
+	sort.SliceStable(info.History, func(i, j int) bool { return info.History[i].Date.After(info.History[j].Date) })
+	return info, nil
+}
+
+// FindTrack build promoted to track of identifier
+func (s *service) FindTrack(identifier, track, publicURL string) (*Item, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, app := range s.list {
+		if app.Identifier == identifier && !app.Trashed() && app.Visible(time.Now()) && hasTag(app.Tracks, track) {
+			return s.itemInfo(app, publicURL), nil
+		}
+	}
+	return nil, ErrTrackNotFound
+}
+
+func removeTag(tags []string, tag string) []string {
+	list := []string{}
+	for _, t := range tags {
+		if t != tag {
+			list = append(list, t)
+		}
+	}
+	return list
+}
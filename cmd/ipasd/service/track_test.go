@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPromote(t *testing.T) {
+	s := newTestService()
+	a1 := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa1", "com.ineva.a")
+	a2 := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaa2", "com.ineva.a")
+	b := testAddAppFiles(t, s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+
+	if err := s.Promote(a1.ID, "Beta!", ""); err != ErrTrackInvalid {
+		t.Fatalf("want ErrTrackInvalid got %v", err)
+	}
+	for _, id := range []string{a1.ID, a2.ID, b.ID} {
+		if err := s.Promote(id, "beta", "qa"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Promote(a1.ID, "production", "release"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a2 replaced a1 on beta, other identifiers not changed
+	info, err := s.Tracks("com.ineva.a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Tracks) != 2 || info.Tracks["beta"].ID != a2.ID || info.Tracks["production"].ID != a1.ID {
+		t.Fatalf("tracks not match: %+v", info.Tracks)
+	}
+	if len(info.History) != 3 || info.History[0].Track != "production" || info.History[0].Actor != "release" {
+		t.Fatalf("history not match: %+v", info.History)
+	}
+	if item, err := s.FindTrack("com.ineva.b", "beta", ""); err != nil || item.ID != b.ID {
+		t.Fatalf("track of other identifier changed: %v %v", item, err)
+	}
+
+	// trashed build not resolved, history kept
+	if err := s.Delete(a2.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FindTrack("com.ineva.a", "beta", ""); err != ErrTrackNotFound {
+		t.Fatalf("want ErrTrackNotFound got %v", err)
+	}
+	if info, _ := s.Tracks("com.ineva.a", ""); len(info.History) != 3 {
+		t.Fatalf("history of trashed build lost: %+v", info.History)
+	}
+
+	// batch track
+	if _, err := s.Batch(&BatchRequest{Action: BatchTrack, IDs: []string{b.ID}, Track: "production"}); err != nil {
+		t.Fatal(err)
+	}
+	if item, err := s.FindTrack("com.ineva.b", "production", ""); err != nil || item.ID != b.ID {
+		t.Fatalf("batch track not promoted: %v %v", item, err)
+	}
+}
+
+func TestTrackURL(t *testing.T) {
+	s := newTestService()
+	a := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	a.Name = "A"
+	if err := s.Promote(a.ID, "beta", ""); err != nil {
+		t.Fatal(err)
+	}
+	e := MakeTrackURLEndpoint(s)
+
+	for path, want := range map[string]string{
+		"/apps/com.ineva.a/tracks/beta":       "/app/?id=" + a.ID,
+		"/apps/com.ineva.a/tracks/beta.ipa":   "https://example.com/" + a.PackageStorageName(),
+		"/apps/com.ineva.a/tracks/beta.plist": a.PackageStorageName(),
+	} {
+		req, err := DecodeTrackURLRequest(context.Background(), httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := e(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		if err := EncodeResolveResponse(context.Background(), w, resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Header().Get("Location") + w.Body.String(); !strings.Contains(got, want) {
+			t.Fatalf("%s: want %s got %s", path, want, got)
+		}
+	}
+
+	req, _ := DecodeTrackURLRequest(context.Background(), httptest.NewRequest("GET", "/apps/com.ineva.a/tracks/beta.apk", nil))
+	if _, err := e(context.Background(), req); err != ErrFormatInvalid {
+		t.Fatalf("want ErrFormatInvalid got %v", err)
+	}
+	if _, err := DecodeTrackURLRequest(context.Background(), httptest.NewRequest("GET", "/apps/com.ineva.a/beta", nil)); err == nil {
+		t.Fatal("invalid path decoded")
+	}
+}
+
+func TestDecodePromoteActor(t *testing.T) {
+	body := `{"id": "aaaaaaaaaaaaaaaaaaaaaa", "track": "beta", "actor": "someone"}`
+	r := httptest.NewRequest("POST", "/api/promote", strings.NewReader(body))
+	req, err := DecodePromoteRequest(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := req.(promoteParam); p.actor != "someone" {
+		t.Fatalf("want actor of body got %s", p.actor)
+	}
+
+	r = httptest.NewRequest("POST", "/api/promote", strings.NewReader(body))
+	r.SetBasicAuth("admin", "pass")
+	req, err = DecodePromoteRequest(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := req.(promoteParam); p.actor != "admin" {
+		t.Fatalf("want basic auth user got %s", p.actor)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/iineva/ipa-server/pkg/common"
@@ -31,8 +32,73 @@ type delParam struct {
 	get       bool // get if delete enabled
 }
 
+type snapshotParam struct {
+	id string
+}
+
+type archiveParam struct {
+	format ArchiveFormat
+	// archive to import
+	body io.Reader
+}
+
+// set pinned or locked of app
+type flagParam struct {
+	id    string
+	value bool
+}
+
+type pruneParam struct {
+	dryRun bool
+}
+
+type reconcileParam struct {
+	fix     bool
+	tempAge time.Duration
+}
+
+type promoteParam struct {
+	id    string
+	track string
+	actor string
+}
+
+type trackParam struct {
+	publicURL  string
+	identifier string
+	track      string
+	// empty for info page, or one of ipa, apk, plist, icon
+	format string
+}
+
+type latestParam struct {
+	publicURL  string
+	identifier string
+	channel    string
+	format     string
+}
+
+// app resolved by stable url, redirect to info page or package, or write plist
+type resolveResponse struct {
+	item   *Item
+	format string
+	plist  []byte
+}
+
+// archive to write to response
+type archiveResponse struct {
+	format ArchiveFormat
+	export func(w io.Writer) error
+}
+
 type addParam struct {
 	file *pkgMultipart.FormFile
+	opts *AddOptions
+}
+
+type editParam struct {
+	id    string
+	patch *AppPatch
 }
 
 type data interface{}
@@ -42,7 +108,8 @@ type response struct {
 }
 
 var (
-	ErrIdInvalid = errors.New("id invalid")
+	ErrIdInvalid     = errors.New("id invalid")
+	ErrFormatInvalid = errors.New("format invalid")
 )
 
 func MakeListEndpoint(srv Service, uploadDisabled bool) endpoint.Endpoint {
@@ -77,7 +144,7 @@ func MakeAddEndpoint(srv Service, uploadDisabled bool) endpoint.Endpoint {
 			return nil, fmt.Errorf("do not support %s file", path.Ext(p.file.FileName()))
 		}
 
-		app, err := srv.Add(buf, p.file.Size(), t)
+		app, err := srv.Add(buf, p.file.Size(), t, p.opts)
 		if err != nil {
 			return nil, err
 		}
@@ -85,6 +152,16 @@ func MakeAddEndpoint(srv Service, uploadDisabled bool) endpoint.Endpoint {
 	}
 }
 
+func MakeEditEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(editParam)
+		if err := srv.Edit(p.id, p.patch); err != nil {
+			return nil, err
+		}
+		return map[string]string{"msg": "ok"}, nil
+	}
+}
+
 func MakeDeleteEndpoint(srv Service, enabledDelete bool) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		if !enabledDelete {
@@ -92,8 +169,7 @@ func MakeDeleteEndpoint(srv Service, enabledDelete bool) endpoint.Endpoint {
 		}
 
 		p := request.(delParam)
-		err := srv.Delete(p.id)
-		if err != nil {
+		if err := srv.Delete(p.id); err != nil {
 			return nil, err
 		}
 		return map[string]string{"msg": "ok"}, nil
@@ -119,6 +195,215 @@ func MakePlistEndpoint(srv Service) endpoint.Endpoint {
 	}
 }
 
+func MakeSnapshotListEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return srv.Snapshots()
+	}
+}
+
+func MakeSnapshotDiffEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(snapshotParam)
+		return srv.DiffSnapshot(p.id)
+	}
+}
+
+func MakeSnapshotRestoreEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(snapshotParam)
+		if err := srv.RestoreSnapshot(p.id); err != nil {
+			return nil, err
+		}
+		return map[string]string{"msg": "ok"}, nil
+	}
+}
+
+func MakeExportEndpoint(srv Service, enabledArchive bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if !enabledArchive {
+			return nil, errors.New("export was disabled")
+		}
+
+		p := request.(archiveParam)
+		return archiveResponse{format: p.format, export: func(w io.Writer) error {
+			return srv.Export(w, p.format)
+		}}, nil
+	}
+}
+
+func MakeImportEndpoint(srv Service, enabledArchive bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if !enabledArchive {
+			return nil, errors.New("import was disabled")
+		}
+
+		p := request.(archiveParam)
+		return srv.Import(p.body, p.format)
+	}
+}
+
+func MakeReconcileEndpoint(srv Service, enabledFix bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(reconcileParam)
+		if p.fix && !enabledFix {
+			return nil, errors.New("reconcile fix was disabled")
+		}
+		return srv.Reconcile(p.fix, p.tempAge)
+	}
+}
+
+func MakeScheduledEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(param)
+		return srv.Scheduled(p.publicURL)
+	}
+}
+
+func MakeTrashEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(param)
+		return srv.Trash(p.publicURL)
+	}
+}
+
+func MakeRestoreEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(param)
+		if err := srv.Restore(p.id); err != nil {
+			return nil, err
+		}
+		return map[string]string{"msg": "ok"}, nil
+	}
+}
+
+func MakePurgeEndpoint(srv Service, enabledDelete bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if !enabledDelete {
+			return nil, errors.New("no permission to delete")
+		}
+
+		p := request.(param)
+		if err := srv.Purge(p.id); err != nil {
+			return nil, err
+		}
+		return map[string]string{"msg": "ok"}, nil
+	}
+}
+
+func MakeBatchEndpoint(srv Service, enabledDelete, enabledLock bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		r := request.(*BatchRequest)
+		if r.Action == BatchDelete && !enabledDelete {
+			return nil, errors.New("no permission to delete")
+		}
+		if (r.Action == BatchLock || r.Action == BatchUnlock) && !enabledLock {
+			return nil, ErrAuthRequired
+		}
+		return srv.Batch(r)
+	}
+}
+
+func MakePinEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(flagParam)
+		if err := srv.SetPinned(p.id, p.value); err != nil {
+			return nil, err
+		}
+		return map[string]string{"msg": "ok"}, nil
+	}
+}
+
+func MakeLockEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(flagParam)
+		if err := srv.SetLocked(p.id, p.value); err != nil {
+			return nil, err
+		}
+		return map[string]string{"msg": "ok"}, nil
+	}
+}
+
+func MakePromoteEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(promoteParam)
+		if err := srv.Promote(p.id, p.track, p.actor); err != nil {
+			return nil, err
+		}
+		return map[string]string{"msg": "ok"}, nil
+	}
+}
+
+func MakeTracksEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(trackParam)
+		return srv.Tracks(p.identifier, p.publicURL)
+	}
+}
+
+func MakeTrackURLEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(trackParam)
+		item, err := srv.FindTrack(p.identifier, p.track, p.publicURL)
+		if err != nil {
+			return nil, err
+		}
+		return newResolveResponse(item, p.format)
+	}
+}
+
+func MakeLatestEndpoint(srv Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(latestParam)
+		t := AppInfoTypeUnknown
+		switch p.format {
+		case "ipa", "plist":
+			t = AppInfoTypeIpa
+		case "apk":
+			t = AppInfoTypeApk
+		}
+		item, err := srv.Latest(p.identifier, p.channel, t, p.publicURL)
+		if err != nil {
+			return nil, err
+		}
+		return newResolveResponse(item, p.format)
+	}
+}
+
+func newResolveResponse(item *Item, format string) (interface{}, error) {
+	switch format {
+	case "", "icon":
+	case "ipa", "plist":
+		if item.Type != AppInfoTypeIpa {
+			return nil, ErrFormatInvalid
+		}
+	case "apk":
+		if item.Type != AppInfoTypeApk {
+			return nil, ErrFormatInvalid
+		}
+	default:
+		return nil, ErrFormatInvalid
+	}
+	resp := resolveResponse{item: item, format: format}
+	if format == "plist" {
+		d, err := NewInstallPlist(item)
+		if err != nil {
+			return nil, err
+		}
+		resp.plist = d
+	}
+	return resp, nil
+}
+
+func MakePruneEndpoint(srv Service, enabledPrune bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		p := request.(pruneParam)
+		if !p.dryRun && !enabledPrune {
+			return nil, errors.New("prune was disabled")
+		}
+		return srv.Prune(p.dryRun)
+	}
+}
+
 func DecodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	// http://localhost/api/list
 	return param{publicURL: publicURL(r)}, nil
@@ -143,13 +428,37 @@ func DecodeAddRequest(_ context.Context, r *http.Request) (interface{}, error) {
 		return nil, errors.New("404")
 	}
 
+	// form fields before file: notes, publishAt, expireAt
 	m := pkgMultipart.New(r)
 	f, err := m.GetFormFile("file")
 	if err != nil {
 		return nil, err
 	}
+	opts, err := ParseAddOptions(m.Value)
+	if err != nil {
+		return nil, err
+	}
 
-	return addParam{file: f}, nil
+	return addParam{file: f, opts: opts}, nil
+}
+
+func DecodeEditRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// PATCH http://localhost/api/info/{id}
+	// body: {"name": "<display name>", "notes": "<markdown>", "publishAt": "<RFC3339>", "expireAt": "<RFC3339>"}
+	if r.Method != http.MethodPatch {
+		return nil, errors.New("404")
+	}
+
+	id := filepath.Base(r.URL.Path)
+	if err := tryMatchID(id); err != nil {
+		return nil, ErrIdInvalid
+	}
+
+	p := &AppPatch{}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		return nil, err
+	}
+	return editParam{id: id, patch: p}, nil
 }
 
 func DecodeDeleteRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -182,6 +491,243 @@ func DecodePlistRequest(_ context.Context, r *http.Request) (interface{}, error)
 	return param{publicURL: publicURL(r), id: id}, nil
 }
 
+func DecodeSnapshotListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/snapshot/list
+	return snapshotParam{}, nil
+}
+
+func DecodeSnapshotDiffRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/snapshot/diff/{id}
+	id := filepath.Base(r.URL.Path)
+	if err := tryMatchSnapshotID(id); err != nil {
+		return nil, err
+	}
+	return snapshotParam{id: id}, nil
+}
+
+func DecodeSnapshotRestoreRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/snapshot/restore
+	if r.Method != http.MethodPost {
+		return nil, errors.New("404")
+	}
+
+	p := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	id := p["id"]
+	if err := tryMatchSnapshotID(id); err != nil {
+		return nil, err
+	}
+	return snapshotParam{id: id}, nil
+}
+
+func DecodeExportRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/export?format=zip
+	format, err := ParseArchiveFormat(common.Def(r.URL.Query().Get("format"), string(ArchiveFormatTar)))
+	if err != nil {
+		return nil, err
+	}
+	return archiveParam{format: format}, nil
+}
+
+func DecodeImportRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/import?format=zip, body is archive
+	if r.Method != http.MethodPost {
+		return nil, errors.New("404")
+	}
+	format, err := ParseArchiveFormat(common.Def(r.URL.Query().Get("format"), string(ArchiveFormatTar)))
+	if err != nil {
+		return nil, err
+	}
+	return archiveParam{format: format, body: r.Body}, nil
+}
+
+func DecodeReconcileRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/reconcile?tempAge=24h
+	// GET to report only, POST to delete orphans and stale temps, remove dangling apps
+	tempAge, err := time.ParseDuration(common.Def(r.URL.Query().Get("tempAge"), DefaultTempAge.String()))
+	if err != nil {
+		return nil, err
+	}
+	return reconcileParam{fix: r.Method == http.MethodPost, tempAge: tempAge}, nil
+}
+
+func DecodeScheduledRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/scheduled
+	return param{publicURL: publicURL(r)}, nil
+}
+
+func DecodeTrashRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/trash
+	return param{publicURL: publicURL(r)}, nil
+}
+
+func DecodeTrashItemRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/trash/restore
+	// http://localhost/api/trash/purge
+	if r.Method != http.MethodPost {
+		return nil, errors.New("404")
+	}
+
+	p := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	id := p["id"]
+	if err := tryMatchID(id); err != nil {
+		return nil, err
+	}
+	return param{id: id}, nil
+}
+
+func DecodeBatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/batch
+	if r.Method != http.MethodPost {
+		return nil, errors.New("404")
+	}
+
+	p := &BatchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		return nil, err
+	}
+	for _, id := range p.IDs {
+		if err := tryMatchID(id); err != nil {
+			return nil, err
+		}
+	}
+	// basic auth user verified by middleware, body actor only used when auth disabled
+	if user, _, ok := r.BasicAuth(); ok {
+		p.Actor = user
+	}
+	return p, nil
+}
+
+func DecodePinRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/pin
+	return decodeFlagRequest(r, "pinned")
+}
+
+func DecodeLockRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/lock
+	return decodeFlagRequest(r, "locked")
+}
+
+// body: {"id": "<id>", "<key>": true}
+func decodeFlagRequest(r *http.Request, key string) (interface{}, error) {
+	if r.Method != http.MethodPost {
+		return nil, errors.New("404")
+	}
+
+	p := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	id, _ := p["id"].(string)
+	if err := tryMatchID(id); err != nil {
+		return nil, err
+	}
+	value, ok := p[key].(bool)
+	if !ok {
+		return nil, fmt.Errorf("%s required", key)
+	}
+	return flagParam{id: id, value: value}, nil
+}
+
+func DecodePromoteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/promote
+	// body: {"id": "<id>", "track": "beta", "actor": "<name>"}, actor is basic auth user if auth enabled
+	if r.Method != http.MethodPost {
+		return nil, errors.New("404")
+	}
+
+	p := map[string]string{}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	id := p["id"]
+	if err := tryMatchID(id); err != nil {
+		return nil, err
+	}
+	if err := ValidTrack(p["track"]); err != nil {
+		return nil, err
+	}
+	// basic auth user verified by middleware, body actor only used when auth disabled
+	actor := p["actor"]
+	if user, _, ok := r.BasicAuth(); ok {
+		actor = user
+	}
+	return promoteParam{id: id, track: p["track"], actor: actor}, nil
+}
+
+func DecodeTracksRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/tracks/{identifier}
+	identifier := filepath.Base(r.URL.Path)
+	if identifier == "" || identifier == "." || identifier == "/" {
+		return nil, errors.New("identifier required")
+	}
+	return trackParam{publicURL: publicURL(r), identifier: identifier}, nil
+}
+
+func DecodeTrackURLRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/apps/{identifier}/tracks/{track}
+	// http://localhost/apps/{identifier}/tracks/{track}.ipa|.apk|.plist
+	parts := strings.Split(strings.Trim(path.Clean(r.URL.Path), "/"), "/")
+	if len(parts) != 4 || parts[0] != "apps" || parts[2] != "tracks" {
+		return nil, errors.New("404")
+	}
+	track, format := parts[3], ""
+	if ext := path.Ext(track); ext != "" {
+		track, format = strings.TrimSuffix(track, ext), ext[1:]
+	}
+	if err := ValidTrack(track); err != nil {
+		return nil, err
+	}
+	return trackParam{publicURL: publicURL(r), identifier: parts[1], track: track, format: format}, nil
+}
+
+func DecodeLatestRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/latest/{identifier}[/{channel}]
+	// http://localhost/latest/{identifier}[/{channel}].ipa|.apk|.plist
+	// http://localhost/latest/{identifier}[/{channel}]/icon.png
+	parts := strings.Split(strings.Trim(path.Clean(r.URL.Path), "/"), "/")
+	if len(parts) < 2 || parts[0] != "latest" {
+		return nil, errors.New("404")
+	}
+	parts = parts[1:]
+	format := ""
+	last := parts[len(parts)-1]
+	if last == "icon.png" {
+		format, parts = "icon", parts[:len(parts)-1]
+	} else {
+		// identifier has dots, only trim known extensions
+		for _, ext := range []string{"ipa", "apk", "plist"} {
+			if strings.HasSuffix(last, "."+ext) {
+				format, parts[len(parts)-1] = ext, strings.TrimSuffix(last, "."+ext)
+				break
+			}
+		}
+	}
+	if len(parts) < 1 || len(parts) > 2 || parts[0] == "" {
+		return nil, errors.New("404")
+	}
+	p := latestParam{publicURL: publicURL(r), identifier: parts[0], format: format}
+	if len(parts) == 2 {
+		p.channel = parts[1]
+	}
+	return p, nil
+}
+
+func DecodePruneRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	// http://localhost/api/retention
+	// GET to report builds to prune, POST to prune now
+	return pruneParam{dryRun: r.Method != http.MethodPost}, nil
+}
+
 func EncodeJsonResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	return json.NewEncoder(w).Encode(response)
 }
@@ -198,6 +744,38 @@ func EncodePlistResponse(_ context.Context, w http.ResponseWriter, response inte
 	return nil
 }
 
+func EncodeResolveResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(resolveResponse)
+	// resolved on each request
+	w.Header().Set("Cache-Control", "no-cache")
+	switch resp.format {
+	case "plist":
+		w.Header().Set("Content-Type", "application/xml")
+		_, err := w.Write(resp.plist)
+		return err
+	case "":
+		w.Header().Set("Location", fmt.Sprintf("/app/?id=%s", resp.item.ID))
+	case "icon":
+		w.Header().Set("Location", resp.item.WebIcon)
+	default:
+		w.Header().Set("Location", resp.item.Pkg)
+	}
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+func EncodeArchiveResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	a := response.(archiveResponse)
+	name := fmt.Sprintf("ipa-server-%s.%s", time.Now().Format("20060102150405"), a.format)
+	contentType := "application/zip"
+	if a.format == ArchiveFormatTar {
+		contentType = "application/x-tar"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	return a.export(w)
+}
+
 // auto check public url from frontend
 func publicURL(ctx *http.Request) string {
 	ref := ctx.Header.Get("referer")
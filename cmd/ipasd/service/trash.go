@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNotTrashed = errors.New("app not in trash")
+)
+
+// find app in trash
+func (s *service) findTrashed(id string) (*AppInfo, error) {
+	for _, row := range s.list {
+		if row.ID == id {
+			if !row.Trashed() {
+				return nil, ErrNotTrashed
+			}
+			return row, nil
+		}
+	}
+	return nil, ErrIdNotFound
+}
+
+// Trash apps deleted but not purged, latest deleted first
+func (s *service) Trash(publicURL string) ([]*Item, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	list := []*Item{}
+	for _, row := range s.list {
+		if row.Trashed() {
+			list = append(list, s.itemInfo(row, publicURL))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].DeletedAt.After(*list[j].DeletedAt) })
+	return list, nil
+}
+
+// Restore app from trash
+func (s *service) Restore(id string) error {
+	s.lock.Lock()
+	app, err := s.findTrashed(id)
+	if err == nil {
+		app.DeletedAt = nil
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.saveMetadata()
+}
+
+// Purge remove app in trash from metadata and delete its files
+func (s *service) Purge(id string) error {
+	return s.purge(id, s.saveMetadata)
+}
+
+func (s *service) purge(id string, save func() error) error {
+	s.lock.Lock()
+	app, err := s.findTrashed(id)
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	for i, a := range s.list {
+		if a == app {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+			break
+		}
+	}
+	// files still referenced by alias apps
+	shared := map[string]bool{}
+	for _, name := range app.StorageNames() {
+		shared[name] = s.storageRefs(name) > 0
+	}
+	s.lock.Unlock()
+
+	if err := save(); err != nil {
+		return err
+	}
+
+	// delete other files even if one failed, failed files are left as orphans
+	errs := []error{}
+	for _, name := range app.StorageNames() {
+		if shared[name] {
+			continue
+		}
+		if err := s.store.Delete(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PurgeTrash purge apps in trash longer than trash retention, return IDs of purged apps
+func (s *service) PurgeTrash() ([]string, error) {
+	purged := []string{}
+	if s.trashRetention <= 0 {
+		return purged, nil
+	}
+	s.lock.RLock()
+	expired := []string{}
+	for _, row := range s.list {
+		if row.Trashed() && time.Since(*row.DeletedAt) > s.trashRetention {
+			expired = append(expired, row.ID)
+		}
+	}
+	s.lock.RUnlock()
+
+	for _, id := range expired {
+		// purged by background job, no snapshot taken
+		if err := s.purge(id, s.saveMetadataAuto); err != nil {
+			// NOTE: restored or purged by others
+			if err == ErrIdNotFound || err == ErrNotTrashed {
+				continue
+			}
+			return purged, err
+		}
+		purged = append(purged, id)
+	}
+	return purged, nil
+}
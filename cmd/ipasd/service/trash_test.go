@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+func TestTrash(t *testing.T) {
+	s := newTestService(WithTrashRetention(24 * time.Hour))
+	a := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	b := testAddAppFiles(t, s, "bbbbbbbbbbbbbbbbbbbbbb", "com.ineva.b")
+
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(a.ID); err != ErrIdNotFound {
+		t.Fatalf("want ErrIdNotFound got %v", err)
+	}
+	if _, err := s.Find(a.ID, ""); err != ErrIdNotFound {
+		t.Fatal("trashed app should be hidden")
+	}
+	if s.PackageVisible(a.PackageStorageName()) {
+		t.Fatal("package of trashed app should be hidden")
+	}
+	list, err := s.List("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := list["list"].([]*Item); len(items) != 1 || items[0].ID != b.ID {
+		t.Fatalf("trashed app listed: %+v", items)
+	}
+	for _, name := range a.StorageNames() {
+		r, err := s.store.OpenMetadata(name)
+		if err != nil {
+			t.Fatalf("file %s of trashed app deleted", name)
+		}
+		r.Close()
+	}
+	trash, err := s.Trash("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != a.ID || trash[0].DeletedAt == nil {
+		t.Fatalf("trash not match: %+v", trash)
+	}
+
+	// restore
+	if err := s.Restore(b.ID); err != ErrNotTrashed {
+		t.Fatalf("want ErrNotTrashed got %v", err)
+	}
+	if err := s.Restore(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Find(a.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// auto purge expired
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-48 * time.Hour)
+	a.DeletedAt = &expired
+	purged, err := s.PurgeTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0] != a.ID || len(s.list) != 1 {
+		t.Fatalf("expired app not purged: %v", purged)
+	}
+	for _, name := range a.StorageNames() {
+		if _, err := s.store.OpenMetadata(name); err == nil {
+			t.Fatalf("file %s of purged app not deleted", name)
+		}
+	}
+
+	if err := s.Purge(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Purge(b.ID); err != ErrIdNotFound {
+		t.Fatalf("want ErrIdNotFound got %v", err)
+	}
+}
+
+type undeletableStorager struct {
+	storager.Storager
+	name string
+}
+
+func (u *undeletableStorager) Delete(name string) error {
+	if name == u.name {
+		return errors.New("delete failed")
+	}
+	return u.Storager.Delete(name)
+}
+
+func TestPurgeDeleteFailed(t *testing.T) {
+	store := &undeletableStorager{Storager: storager.NewMemStorager()}
+	s := New(store, "https://example.com", "appList.json").(*service)
+	a := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	store.name = a.PackageStorageName()
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// icon deleted even if package failed
+	if err := s.Purge(a.ID); err == nil {
+		t.Fatal("want delete error")
+	}
+	if _, err := s.store.OpenMetadata(a.IconStorageName()); err == nil {
+		t.Fatal("icon of purged app not deleted")
+	}
+	if len(s.list) != 0 {
+		t.Fatal("purged app not removed")
+	}
+}
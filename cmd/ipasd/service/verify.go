@@ -0,0 +1,127 @@
+package service
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// VerifyResult app IDs of verify
+type VerifyResult struct {
+	Checked int `json:"checked"`
+	// checksums computed for apps uploaded before checksums supported
+	Backfilled []string `json:"backfilled"`
+	// package checksum not match
+	Corrupted []string `json:"corrupted"`
+	// package not found
+	Missing []string `json:"missing"`
+}
+
+// hash file while writing
+type packageHash struct {
+	sha256 hashWriter
+	sha1   hashWriter
+}
+
+type hashWriter interface {
+	io.Writer
+	Sum(b []byte) []byte
+}
+
+func newPackageHash() *packageHash {
+	return &packageHash{sha256: sha256.New(), sha1: sha1.New()}
+}
+
+func (h *packageHash) Write(p []byte) (int, error) {
+	h.sha256.Write(p)
+	return h.sha1.Write(p)
+}
+
+func (h *packageHash) SHA256() string {
+	return hex.EncodeToString(h.sha256.Sum(nil))
+}
+
+func (h *packageHash) SHA1() string {
+	return hex.EncodeToString(h.sha1.Sum(nil))
+}
+
+// FindByStorageName app of package storage name
+func (s *service) FindByStorageName(name string) (*AppInfo, error) {
+	name = strings.TrimPrefix(name, "/")
+	// static files and icons are never packages, skip scanning list
+	if FileType(name) == AppInfoTypeUnknown {
+		return nil, ErrIdNotFound
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, row := range s.list {
+		if row.PackageStorageName() == name && !row.Trashed() {
+			return row, nil
+		}
+	}
+	return nil, ErrIdNotFound
+}
+
+// Verify hash stored packages again, flag apps whose checksum not match
+func (s *service) Verify() (*VerifyResult, error) {
+	s.lock.RLock()
+	list := append(AppList{}, s.list...)
+	s.lock.RUnlock()
+
+	result := &VerifyResult{Backfilled: []string{}, Corrupted: []string{}, Missing: []string{}}
+	// alias apps share package, hash once
+	hashes := map[string]*packageHash{}
+	missing := map[string]bool{}
+	for _, app := range list {
+		name := app.PackageStorageName()
+		if _, ok := hashes[name]; ok || missing[name] {
+			continue
+		}
+		r, err := s.store.OpenMetadata(name)
+		if err != nil {
+			missing[name] = true
+			continue
+		}
+		h := newPackageHash()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		hashes[name] = h
+		result.Checked++
+	}
+
+	changed := false
+	s.lock.Lock()
+	for _, app := range list {
+		name := app.PackageStorageName()
+		if missing[name] {
+			result.Missing = append(result.Missing, app.ID)
+			continue
+		}
+		h := hashes[name]
+		if app.SHA256 == "" {
+			app.SHA256, app.SHA1 = h.SHA256(), h.SHA1()
+			result.Backfilled = append(result.Backfilled, app.ID)
+			changed = true
+			continue
+		}
+		corrupted := app.SHA256 != h.SHA256()
+		if corrupted {
+			result.Corrupted = append(result.Corrupted, app.ID)
+		}
+		if app.Corrupted != corrupted {
+			app.Corrupted = corrupted
+			changed = true
+		}
+	}
+	s.lock.Unlock()
+
+	if !changed {
+		return result, nil
+	}
+	return result, s.saveMetadataAuto()
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	s := newTestService()
+	a := testAddIpa(t, s)
+	if a.SHA256 == "" || a.SHA1 == "" {
+		t.Fatal("checksums not computed")
+	}
+	// uploaded before checksums supported
+	old := testAddAppFiles(t, s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+
+	result, err := s.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Checked != 2 || len(result.Backfilled) != 1 || len(result.Corrupted) != 0 {
+		t.Fatalf("verify result not match: %+v", result)
+	}
+	if old.SHA256 == "" {
+		t.Fatal("checksums not backfilled")
+	}
+
+	if err := s.store.Save(a.PackageStorageName(), bytes.NewBufferString("broken")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = s.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Corrupted) != 1 || result.Corrupted[0] != a.ID || !a.Corrupted {
+		t.Fatalf("corrupted not flagged: %+v", result)
+	}
+	item, err := s.Find(a.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !item.Corrupted || item.SHA256 != a.SHA256 {
+		t.Fatalf("item checksums not match: %+v", item)
+	}
+
+	if err := s.store.Delete(old.PackageStorageName()); err != nil {
+		t.Fatal(err)
+	}
+	result, err = s.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Missing) != 1 || result.Missing[0] != old.ID {
+		t.Fatalf("missing not found: %+v", result)
+	}
+}
+
+func TestFindByStorageName(t *testing.T) {
+	s := newTestService()
+	a := testAddApp(s, "aaaaaaaaaaaaaaaaaaaaaa", "com.ineva.a")
+	a.Type = AppInfoTypeIpa
+	if app, err := s.FindByStorageName("/" + a.PackageStorageName()); err != nil || app.ID != a.ID {
+		t.Fatalf("package not found: %v %v", app, err)
+	}
+	if _, err := s.FindByStorageName("/css/core.css"); err != ErrIdNotFound {
+		t.Fatalf("want ErrIdNotFound got %v", err)
+	}
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FindByStorageName(a.PackageStorageName()); err != ErrIdNotFound {
+		t.Fatal("trashed app found")
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import "strings"
+
+// compare dot separated versions segment by segment, numeric segments compared as numbers: 1.10 > 1.9
+func compareVersion(a, b string) int {
+	as := strings.Split(strings.TrimSpace(a), ".")
+	bs := strings.Split(strings.TrimSpace(b), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if c := compareSegment(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compare numeric prefix of segments as numbers then suffix: 1.10-rc > 1.9, pre-release suffix is lower: 1.10 > 1.10-rc
+func compareSegment(a, b string) int {
+	x, sa := splitSegment(a)
+	y, sb := splitSegment(b)
+	switch {
+	case x != "" && y != "":
+		// numbers without leading zeros, longer is greater
+		if len(x) != len(y) {
+			return compareInt(len(x), len(y))
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+		if sa == "" || sb == "" {
+			// bare number is greater than pre-release: 1.0 > 1.0-beta
+			return compareInt(len(sb), len(sa))
+		}
+		return strings.Compare(sa, sb)
+	case x != "":
+		// numeric segment is greater than text: 1.0 > 1.beta
+		return 1
+	case y != "":
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// split segment into numeric prefix without leading zeros and suffix: 010-rc -> 10 -rc
+func splitSegment(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return "", s
+	}
+	n := strings.TrimLeft(s[:i], "0")
+	if n == "" {
+		n = "0"
+	}
+	return n, s[i:]
+}
+
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
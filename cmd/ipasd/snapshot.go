@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+)
+
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	cfg := &storageConfig{}
+	cfg.register(fs)
+	keep := fs.Int("snapshot-keep", defaultSnapshotKeep, "metadata snapshots to keep")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: ipasd snapshot [options] list|diff <id>|restore <id>
+NOTE: restore rewrite metadata in storage, restart running server to reload it, or use /api/snapshot/restore instead.
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	store, err := cfg.newStorager(newLogger())
+	if err != nil {
+		return err
+	}
+	srv := service.New(store, "", cfg.metaPath, service.WithSnapshotRetention(*keep))
+
+	switch fs.Arg(0) {
+	case "list":
+		list, err := srv.Snapshots()
+		if err != nil {
+			return err
+		}
+		return printJSON(list)
+	case "diff":
+		diff, err := srv.DiffSnapshot(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return printJSON(diff)
+	case "restore":
+		if err := srv.RestoreSnapshot(fs.Arg(1)); err != nil {
+			return err
+		}
+		return printJSON(map[string]string{"msg": "ok"})
+	}
+	fs.Usage()
+	os.Exit(2)
+	return nil
+}
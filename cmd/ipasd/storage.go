@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/iineva/ipa-server/pkg/storager"
+)
+
+// storage flags shared by server and sub commands
+type storageConfig struct {
+	dir       string
+	metaPath  string
+	remote    string
+	remoteURL string
+	// mirror tiers, same order as mirrorURLs
+	mirrors    stringsFlag
+	mirrorURLs stringsFlag
+	preferTier int
+	// key file to encrypt files
+	encryptionKey string
+	// refuse to read files not encrypted
+	encryptionStrict bool
+}
+
+// flag can be set multiple times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func (c *storageConfig) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.dir, "dir", "upload", "upload data storage dir")
+	fs.StringVar(&c.metaPath, "meta-path", "appList.json", "metadata storage path, use random secret path to keep your metadata safer")
+	fs.StringVar(&c.remote, "remote", "", "remote storager DSN, scheme://[USER[:PASSWORD]@][HOST[:PORT]]/PATH[?OPTIONS], scheme: s3 alioss qiniu azure gcs webdav sftp file, eg: s3://AK:SK@minio.example.com:9000/bucket?region=us-east-1&pathStyle=true&prefix=ipa/")
+	fs.Var(&c.mirrors, "mirror", "mirror storager DSN, same format as -remote, can be set multiple times, files are saved to storage and all mirrors")
+	fs.Var(&c.mirrorURLs, "mirror-url", "mirror storager public url, same order as -mirror, can be empty like -remote-url")
+	fs.IntVar(&c.preferTier, "prefer-tier", 0, "storage tier to serve downloads, fall back to others if failed, 0: storage set by -remote or -dir, 1: first mirror")
+	fs.StringVar(&c.encryptionKey, "encryption-key", "", "key file to encrypt files at rest with AES-GCM, one ID:BASE64_KEY each line, first key encrypts new files, downloads go over server")
+	fs.BoolVar(&c.encryptionStrict, "encryption-strict", false, "refuse to read files not encrypted, set after files saved before -encryption-key are migrated")
+	fs.StringVar(&c.remoteURL, "remote-url", "", "remote storager public url, https://cdn.example.com, private bucket (private=true) of s3 alioss and azure gcs can leave it empty to use signed url, required by qiniu, webdav sftp and file can leave it empty to download over server")
+}
+
+func (c *storageConfig) newStorager(logger log.Logger) (storager.Storager, error) {
+	store, err := c.newMirrorStorager(logger)
+	if err != nil || c.encryptionKey == "" {
+		return store, err
+	}
+
+	keys, err := storager.LoadKeyring(c.encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log("msg", "used encrypt storager")
+	e := storager.NewEncryptStorager(store, keys)
+	e.SetRejectPlain(c.encryptionStrict)
+	return e, nil
+}
+
+func (c *storageConfig) newMirrorStorager(logger log.Logger) (storager.Storager, error) {
+	store, err := c.newPrimaryStorager(logger)
+	if err != nil || len(c.mirrors) == 0 {
+		return store, err
+	}
+
+	mirrors := []storager.Storager{}
+	for i, dsn := range c.mirrors {
+		u := ""
+		if i < len(c.mirrorURLs) {
+			u = c.mirrorURLs[i]
+		}
+		d, err := storager.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		warnInsecure(logger, d)
+		m, err := storager.OpenDSN(d, u)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, m)
+	}
+	logger.Log("msg", fmt.Sprintf("used %d mirror storagers, prefer tier %d", len(mirrors), c.preferTier))
+	return storager.NewMirrorStorager(c.preferTier, store, mirrors...), nil
+}
+
+func (c *storageConfig) newPrimaryStorager(logger log.Logger) (storager.Storager, error) {
+	if c.remote == "" {
+		return c.newOsFileStorager(logger), nil
+	}
+
+	d, err := storager.ParseDSN(c.remote)
+	if err != nil {
+		return nil, err
+	}
+
+	// azure and gcs support private bucket without public url, webdav sftp and file download over server
+	switch d.Scheme {
+	case "azure", "gcs", "webdav", "sftp", "file":
+	default:
+		// private bucket use signed url
+		if c.remoteURL == "" && !d.Private() {
+			return c.newOsFileStorager(logger), nil
+		}
+	}
+
+	logger.Log("msg", "used "+d.Scheme+" storager")
+	warnInsecure(logger, d)
+	return storager.OpenDSN(d, c.remoteURL)
+}
+
+func warnInsecure(logger log.Logger, d *storager.DSN) {
+	if d.Scheme == "sftp" && d.Insecure() {
+		logger.Log("msg", fmt.Sprintf("warning: host key of sftp server %s not verified, remove insecure=true and set knownHosts or hostKey", d.Host))
+	}
+}
+
+func (c *storageConfig) newOsFileStorager(logger log.Logger) storager.Storager {
+	logger.Log("msg", "used os file storager")
+	return storager.NewOsFileStorager(c.dir)
+}
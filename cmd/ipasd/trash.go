@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/iineva/ipa-server/cmd/ipasd/service"
+)
+
+// purge apps in trash longer than -trash-days every interval
+func runPurgeJob(srv service.Service, interval time.Duration, logger log.Logger) {
+	for {
+		time.Sleep(interval)
+		purged, err := srv.PurgeTrash()
+		if err != nil {
+			logger.Log("msg", fmt.Sprintf("purge trash err: %v", err))
+		}
+		if len(purged) > 0 {
+			logger.Log("msg", fmt.Sprintf("purged %d apps from trash", len(purged)))
+		}
+	}
+}
@@ -27,6 +27,14 @@ if [ "$UPLOAD_DISABLED" = "true" -o "$UPLOAD_DISABLED" = "1" ];then
     ipasd_args=$ipasd_args"-upload-disabled "
 fi
 
+if [ "$ARCHIVE_ENABLED" = "true" -o "$ARCHIVE_ENABLED" = "1" ];then
+    ipasd_args=$ipasd_args"-archive "
+fi
+
+if [ "$RECONCILE_FIX" = "true" -o "$RECONCILE_FIX" = "1" ];then
+    ipasd_args=$ipasd_args"-reconcile-fix "
+fi
+
 if [ -n "$META_PATH" ];then
     ipasd_args=$ipasd_args"-meta-path $META_PATH "
 fi
@@ -39,4 +47,72 @@ if [ -n "$LOGIN_PASS" ];then
     ipasd_args=$ipasd_args"-pass $LOGIN_PASS "
 fi
 
+if [ -n "$SNAPSHOT_KEEP" ];then
+    ipasd_args=$ipasd_args"-snapshot-keep $SNAPSHOT_KEEP "
+fi
+
+if [ -n "$MIRROR" ];then
+    ipasd_args=$ipasd_args"-mirror $MIRROR "
+fi
+
+if [ -n "$MIRROR_URL" ];then
+    ipasd_args=$ipasd_args"-mirror-url $MIRROR_URL "
+fi
+
+if [ -n "$PREFER_TIER" ];then
+    ipasd_args=$ipasd_args"-prefer-tier $PREFER_TIER "
+fi
+
+if [ -n "$DEDUP" ];then
+    ipasd_args=$ipasd_args"-dedup $DEDUP "
+fi
+
+if [ -n "$DUPLICATE" ];then
+    ipasd_args=$ipasd_args"-duplicate $DUPLICATE "
+fi
+
+if [ "$STRICT_VERSION_CODE" = "true" -o "$STRICT_VERSION_CODE" = "1" ];then
+    ipasd_args=$ipasd_args"-strict-version-code "
+fi
+
+if [ -n "$SCHEDULE_INTERVAL" ];then
+    ipasd_args=$ipasd_args"-schedule-interval $SCHEDULE_INTERVAL "
+fi
+
+if [ -n "$NOTIFY_URL" ];then
+    ipasd_args=$ipasd_args"-notify-url $NOTIFY_URL "
+fi
+
+if [ -n "$ORDER" ];then
+    ipasd_args=$ipasd_args"-order $ORDER "
+fi
+
+if [ -n "$VERIFY_INTERVAL" ];then
+    ipasd_args=$ipasd_args"-verify-interval $VERIFY_INTERVAL "
+fi
+
+if [ -n "$TRASH_DAYS" ];then
+    ipasd_args=$ipasd_args"-trash-days $TRASH_DAYS "
+fi
+
+if [ -n "$RETENTION" ];then
+    ipasd_args=$ipasd_args"-retention $RETENTION "
+fi
+
+if [ -n "$RETENTION_BUDGET" ];then
+    ipasd_args=$ipasd_args"-retention-budget $RETENTION_BUDGET "
+fi
+
+if [ -n "$PRUNE_INTERVAL" ];then
+    ipasd_args=$ipasd_args"-prune-interval $PRUNE_INTERVAL "
+fi
+
+if [ -n "$ENCRYPTION_KEY" ];then
+    ipasd_args=$ipasd_args"-encryption-key $ENCRYPTION_KEY "
+fi
+
+if [ "$ENCRYPTION_STRICT" = "true" -o "$ENCRYPTION_STRICT" = "1" ];then
+    ipasd_args=$ipasd_args"-encryption-strict "
+fi
+
 /app/ipasd $ipasd_args
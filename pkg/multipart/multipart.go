@@ -4,6 +4,7 @@ package multipart
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
@@ -12,6 +13,8 @@ import (
 
 type MultipartForm struct {
 	r *http.Request
+	// form values before file
+	values map[string]string
 }
 
 type FormFile struct {
@@ -23,19 +26,37 @@ type FormFile struct {
 
 var _ io.Reader = (*FormFile)(nil)
 
+// max size of each form value
+const maxValueSize = 1 << 20
+
 func New(r *http.Request) *MultipartForm {
-	return &MultipartForm{r: r}
+	return &MultipartForm{r: r, values: map[string]string{}}
 }
 
+// GetFormFile return file part to stream, form values before file can be read by Value
 func (m *MultipartForm) GetFormFile(targetName string) (*FormFile, error) {
 	mr, err := m.multipartReader(false)
 	if err != nil {
 		return nil, err
 	}
 
-	p, err := mr.NextPart()
-	if err != nil {
-		return nil, err
+	var p *multipart.Part
+	for {
+		p, err = mr.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if p.FormName() == targetName || p.FileName() != "" {
+			break
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(p, maxValueSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > maxValueSize {
+			return nil, fmt.Errorf("form value %s too large", p.FormName())
+		}
+		m.values[p.FormName()] = string(b)
 	}
 
 	name := p.FormName()
@@ -58,6 +79,11 @@ func (m *MultipartForm) GetFormFile(targetName string) (*FormFile, error) {
 	}, nil
 }
 
+// Value of form field sent before file, fields after file are not read
+func (m *MultipartForm) Value(name string) string {
+	return m.values[name]
+}
+
 // code copy from http/request.go:447
 func (m *MultipartForm) multipartReader(allowMixed bool) (*multipart.Reader, error) {
 	r := m.r
@@ -90,4 +116,4 @@ func (f *FormFile) Name() string {
 
 func (f *FormFile) Size() int64 {
 	return f.size
-}
\ No newline at end of file
+}
@@ -3,7 +3,9 @@ package storager
 import (
 	"bufio"
 	"io"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/iineva/ipa-server/pkg/storager/helper"
 	"github.com/spf13/afero"
@@ -83,7 +85,13 @@ func (f *oferoStorager) deleteEmptyDir(name string) error {
 		return nil
 	}
 
-	err := f.fs.Remove(name)
+	// MemMapFs remove dir with children
+	infos, err := afero.ReadDir(f.fs, name)
+	if err != nil || len(infos) > 0 {
+		return err
+	}
+
+	err = f.fs.Remove(name)
 	if err != nil {
 		return err
 	}
@@ -99,6 +107,29 @@ func (f *oferoStorager) Move(src, dest string) error {
 	return f.fs.Rename(src, dest)
 }
 
+func (f *oferoStorager) List(prefix string) ([]string, error) {
+	names := []string{}
+	// walk from dir of prefix
+	root := filepath.Dir(filepath.Clean(prefix))
+	if strings.HasSuffix(prefix, "/") {
+		root = filepath.Clean(prefix)
+	}
+	err := afero.Walk(f.fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		name = filepath.ToSlash(filepath.Clean(name))
+		if !info.IsDir() && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
 func (f *oferoStorager) PublicURL(publicURL, name string) (string, error) {
 	return helper.UrlJoin(publicURL, name)
 }
@@ -1,8 +1,12 @@
 package storager
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/iineva/ipa-server/pkg/storager/helper"
@@ -12,13 +16,40 @@ type aliossStorager struct {
 	client *oss.Client
 	bucket *oss.Bucket
 	domain string
+	// options of saved objects
+	objectOptions []oss.Option
+	// public url expiry of private bucket
+	signedURLExpiry time.Duration
+	options         *options
 }
 
 var _ Storager = (*aliossStorager)(nil)
 
 // endpoint: https://help.aliyun.com/document_detail/31837.htm
-func NewAliOssStorager(endpoint, accessKeyId, accessKeySecret, bucketName, domain string) (Storager, error) {
-	client, err := oss.New(endpoint, accessKeyId, accessKeySecret, oss.Timeout(10, 120))
+// accessKeyId: empty to use auto refreshed STS credentials of ECS RAM role or credentials URI
+func NewAliOssStorager(endpoint, accessKeyId, accessKeySecret, bucketName, domain string, opts ...Option) (Storager, error) {
+	o := newOptions(opts)
+	objectOptions := []oss.Option{}
+	if o.acl != "" {
+		objectOptions = append(objectOptions, oss.ObjectACL(oss.ACLType(o.acl)))
+	}
+	if o.storageClass != "" {
+		objectOptions = append(objectOptions, oss.ObjectStorageClass(oss.StorageClassType(o.storageClass)))
+	}
+
+	clientOpts := []oss.ClientOption{oss.Timeout(10, 120)}
+	if accessKeyId == "" {
+		// STS credentials of ECS RAM role or credentials URI
+		provider, err := newAliOssCredentialsProvider(o)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, oss.SetCredentialsProvider(provider))
+	} else if o.securityToken != "" {
+		clientOpts = append(clientOpts, oss.SecurityToken(o.securityToken))
+	}
+
+	client, err := oss.New(endpoint, accessKeyId, accessKeySecret, clientOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -26,12 +57,54 @@ func NewAliOssStorager(endpoint, accessKeyId, accessKeySecret, bucketName, domai
 	if err != nil {
 		return nil, err
 	}
-	return &aliossStorager{client: client, bucket: bucket, domain: domain}, nil
+	return &aliossStorager{
+		client:          client,
+		bucket:          bucket,
+		domain:          domain,
+		objectOptions:   objectOptions,
+		signedURLExpiry: o.signedURLExpiry,
+		options:         o,
+	}, nil
 }
 
 func (a *aliossStorager) Save(name string, reader io.Reader) error {
-	r := ioutil.NopCloser(reader) // avoid oss SDK to close reader
-	return a.bucket.PutObject(name, r)
+	return a.options.upload(reader, func(r io.Reader, _ int64) error {
+		return a.bucket.PutObject(name, ioutil.NopCloser(r), a.objectOptions...) // avoid oss SDK to close reader
+	}, func() (partUploader, error) {
+		imur, err := a.bucket.InitiateMultipartUpload(name, a.objectOptions...)
+		if err != nil {
+			return nil, err
+		}
+		return &aliossPartUploader{bucket: a.bucket, imur: imur}, nil
+	})
+}
+
+type aliossPartUploader struct {
+	bucket *oss.Bucket
+	imur   oss.InitiateMultipartUploadResult
+	lock   sync.Mutex
+	parts  []oss.UploadPart
+}
+
+func (u *aliossPartUploader) UploadPart(number int, data []byte) error {
+	part, err := u.bucket.UploadPart(u.imur, bytes.NewReader(data), int64(len(data)), number)
+	if err != nil {
+		return err
+	}
+	u.lock.Lock()
+	u.parts = append(u.parts, part)
+	u.lock.Unlock()
+	return nil
+}
+
+func (u *aliossPartUploader) Complete() error {
+	sort.Slice(u.parts, func(i, j int) bool { return u.parts[i].PartNumber < u.parts[j].PartNumber })
+	_, err := u.bucket.CompleteMultipartUpload(u.imur, u.parts)
+	return err
+}
+
+func (u *aliossPartUploader) Abort() error {
+	return u.bucket.AbortMultipartUpload(u.imur)
 }
 
 func (a *aliossStorager) OpenMetadata(name string) (io.ReadCloser, error) {
@@ -43,13 +116,38 @@ func (a *aliossStorager) Delete(name string) error {
 }
 
 func (a *aliossStorager) Move(src, dest string) error {
-	_, err := a.bucket.CopyObject(src, dest)
+	_, err := a.bucket.CopyObject(src, dest, a.objectOptions...)
 	if err != nil {
 		return err
 	}
 	return a.bucket.DeleteObject(src)
 }
 
+func (a *aliossStorager) List(prefix string) ([]string, error) {
+	names := []string{}
+	token := ""
+	for {
+		opts := []oss.Option{oss.Prefix(prefix), oss.MaxKeys(1000)}
+		if token != "" {
+			opts = append(opts, oss.ContinuationToken(token))
+		}
+		ret, err := a.bucket.ListObjectsV2(opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range ret.Objects {
+			names = append(names, obj.Key)
+		}
+		if !ret.IsTruncated {
+			return names, nil
+		}
+		token = ret.NextContinuationToken
+	}
+}
+
 func (a *aliossStorager) PublicURL(publicURL, name string) (string, error) {
+	if a.signedURLExpiry > 0 {
+		return a.bucket.SignURL(name, oss.HTTPGet, int64(a.signedURLExpiry/time.Second))
+	}
 	return helper.UrlJoin(a.domain, name)
 }
@@ -0,0 +1,129 @@
+package storager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+var (
+	ErrAliOssCredentialsNotFound = errors.New("alioss credentials not found")
+)
+
+const (
+	// refresh STS credentials before expired
+	aliossCredentialsRefreshBefore = 5 * time.Minute
+	// env of ECS RAM role name and credentials URI, same as alibaba cloud SDK
+	aliossRAMRoleEnv        = "ALIBABA_CLOUD_ECS_METADATA"
+	aliossCredentialsURIEnv = "ALIBABA_CLOUD_CREDENTIALS_URI"
+)
+
+// ECS instance metadata endpoint, not constant to allow for swapping during unit-testing
+var aliossMetadataEndpoint = "http://100.100.100.200"
+
+// STS credentials of ECS RAM role or credentials URI
+type aliossCredentials struct {
+	Code            string
+	AccessKeyId     string
+	AccessKeySecret string
+	SecurityToken   string
+	Expiration      time.Time
+}
+
+func (c *aliossCredentials) GetAccessKeyID() string     { return c.AccessKeyId }
+func (c *aliossCredentials) GetAccessKeySecret() string { return c.AccessKeySecret }
+func (c *aliossCredentials) GetSecurityToken() string   { return c.SecurityToken }
+
+// fetch STS credentials from url, refresh automatically before expired
+type aliossCredentialsProvider struct {
+	url    string
+	client *http.Client
+	lock   sync.Mutex
+	creds  *aliossCredentials
+}
+
+var _ oss.CredentialsProvider = (*aliossCredentialsProvider)(nil)
+
+// resolve ambient credentials when access key not set:
+// credentials URI, ECS RAM role from options, then from env
+func newAliOssCredentialsProvider(o *options) (*aliossCredentialsProvider, error) {
+	u := o.credentialsURL
+	if u == "" && o.ramRole != "" {
+		u = aliossRAMRoleURL(o.ramRole)
+	}
+	if u == "" {
+		u = os.Getenv(aliossCredentialsURIEnv)
+	}
+	if u == "" {
+		if role := os.Getenv(aliossRAMRoleEnv); role != "" {
+			u = aliossRAMRoleURL(role)
+		}
+	}
+	if u == "" {
+		return nil, ErrAliOssCredentialsNotFound
+	}
+
+	p := &aliossCredentialsProvider{url: u, client: &http.Client{Timeout: 10 * time.Second}}
+	// check credentials available
+	if _, err := p.credentials(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func aliossRAMRoleURL(role string) string {
+	return aliossMetadataEndpoint + "/latest/meta-data/ram/security-credentials/" + role
+}
+
+func (p *aliossCredentialsProvider) GetCredentials() oss.Credentials {
+	c, err := p.credentials()
+	if err != nil {
+		// NOTE: request will be rejected by server with empty credentials
+		return &aliossCredentials{}
+	}
+	return c
+}
+
+// cached credentials, keep expired one if refresh failed
+func (p *aliossCredentialsProvider) credentials() (*aliossCredentials, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.creds != nil && time.Until(p.creds.Expiration) > aliossCredentialsRefreshBefore {
+		return p.creds, nil
+	}
+	c, err := p.fetch()
+	if err != nil {
+		if p.creds != nil {
+			return p.creds, nil
+		}
+		return nil, err
+	}
+	p.creds = c
+	return c, nil
+}
+
+func (p *aliossCredentialsProvider) fetch() (*aliossCredentials, error) {
+	resp, err := p.client.Get(p.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrAliOssCredentialsNotFound, resp.Status)
+	}
+	c := &aliossCredentials{}
+	if err := json.NewDecoder(resp.Body).Decode(c); err != nil {
+		return nil, err
+	}
+	if (c.Code != "" && c.Code != "Success") || c.AccessKeyId == "" {
+		return nil, fmt.Errorf("%w: code %s", ErrAliOssCredentialsNotFound, c.Code)
+	}
+	return c, nil
+}
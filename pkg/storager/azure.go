@@ -0,0 +1,200 @@
+package storager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+
+	"github.com/iineva/ipa-server/pkg/storager/helper"
+)
+
+type azureStorager struct {
+	client *container.Client
+	domain string
+	// SAS token when client created without shared key
+	sas string
+	// read only SAS token to sign public url when client created without shared key
+	readSAS string
+	options *options
+}
+
+var _ Storager = (*azureStorager)(nil)
+
+var (
+	ErrAzureCopyFailed      = errors.New("azure copy blob failed")
+	ErrAzureReadSASRequired = errors.New("azure read only SAS token required for private container without account key")
+)
+
+const (
+	// interval to check server side copy status
+	azureCopyPollInterval = time.Second
+)
+
+// endpoint: https://ACCOUNT.blob.core.windows.net, empty to use default endpoint of account
+// domain: public url of container, empty for private container to use SAS signed url
+func NewAzureStorager(endpoint, account, accountKey, containerName, domain string, opts ...Option) (Storager, error) {
+	u, err := azureContainerURL(endpoint, account, containerName)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := container.NewSharedKeyCredential(account, accountKey)
+	if err != nil {
+		return nil, err
+	}
+	client, err := container.NewClientWithSharedKeyCredential(u, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureStorager{client: client, domain: domain, options: newOptions(opts)}, nil
+}
+
+// sasToken: SAS token with read, write, delete permissions of container, without leading "?", never published.
+// readSASToken: SAS token with read permission only, used in public url of private container,
+// required if domain is empty or signed url enabled
+func NewAzureSASStorager(endpoint, account, sasToken, readSASToken, containerName, domain string, opts ...Option) (Storager, error) {
+	u, err := azureContainerURL(endpoint, account, containerName)
+	if err != nil {
+		return nil, err
+	}
+	sasToken = strings.TrimPrefix(sasToken, "?")
+	readSASToken = strings.TrimPrefix(readSASToken, "?")
+	for _, token := range []string{sasToken, readSASToken} {
+		if _, err := url.ParseQuery(token); err != nil {
+			return nil, err
+		}
+	}
+	o := newOptions(opts)
+	if readSASToken == "" && (domain == "" || o.signedURLExpiry != 0) {
+		return nil, ErrAzureReadSASRequired
+	}
+	client, err := container.NewClientWithNoCredential(u+"?"+sasToken, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureStorager{client: client, domain: domain, sas: sasToken, readSAS: readSASToken, options: o}, nil
+}
+
+// access tier of saved blobs
+func (a *azureStorager) tier() *blob.AccessTier {
+	if a.options.storageClass == "" {
+		return nil
+	}
+	tier := blob.AccessTier(a.options.storageClass)
+	return &tier
+}
+
+func azureContainerURL(endpoint, account, containerName string) (string, error) {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" {
+		u, err = url.Parse("https://" + endpoint)
+		if err != nil {
+			return "", err
+		}
+	}
+	return helper.UrlJoin(u.String(), containerName)
+}
+
+func (a *azureStorager) Save(name string, reader io.Reader) error {
+	_, err := a.client.NewBlockBlobClient(name).UploadStream(context.Background(), reader, &blockblob.UploadStreamOptions{
+		AccessTier: a.tier(),
+	})
+	return err
+}
+
+func (a *azureStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	resp, err := a.client.NewBlobClient(name).DownloadStream(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (a *azureStorager) Delete(name string) error {
+	_, err := a.client.NewBlobClient(name).Delete(context.Background(), nil)
+	return err
+}
+
+func (a *azureStorager) Move(src, dest string) error {
+	ctx := context.Background()
+	srcURL := a.client.NewBlobClient(src).URL()
+	if a.sas != "" && !strings.Contains(srcURL, "?") {
+		srcURL = srcURL + "?" + a.sas
+	}
+	d := a.client.NewBlobClient(dest)
+	resp, err := d.StartCopyFromURL(ctx, srcURL, &blob.StartCopyFromURLOptions{
+		Tier: a.tier(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// wait server side copy done
+	status := resp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		time.Sleep(azureCopyPollInterval)
+		props, err := d.GetProperties(ctx, nil)
+		if err != nil {
+			return err
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return ErrAzureCopyFailed
+	}
+
+	return a.Delete(src)
+}
+
+func (a *azureStorager) List(prefix string) ([]string, error) {
+	names := []string{}
+	pager := a.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		resp, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Segment.BlobItems {
+			if item.Name != nil {
+				names = append(names, *item.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (a *azureStorager) PublicURL(_, name string) (string, error) {
+	if a.domain != "" && a.options.signedURLExpiry == 0 {
+		return helper.UrlJoin(a.domain, name)
+	}
+
+	// private container
+	b := a.client.NewBlobClient(name)
+	if a.sas != "" {
+		if a.readSAS == "" {
+			return "", ErrAzureReadSASRequired
+		}
+		// url of client contains SAS token with write permission
+		u, err := url.Parse(b.URL())
+		if err != nil {
+			return "", err
+		}
+		u.RawQuery = a.readSAS
+		return u.String(), nil
+	}
+	return b.GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(a.options.expiry()), nil)
+}
@@ -0,0 +1,46 @@
+package storager
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// run Azurite emulator first:
+// docker run -p 10000:10000 mcr.microsoft.com/azure-storage/azurite azurite-blob --blobHost 0.0.0.0
+func TestAzure(t *testing.T) {
+
+	// Azurite well-known development account
+	endpoint := "http://127.0.0.1:10000/devstoreaccount1"
+	account := "devstoreaccount1"
+	accountKey := "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	containerName := "ipa-server"
+	domain := ""
+
+	a, err := NewAzureStorager(endpoint, account, accountKey, containerName, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: ignore error, container may already exist
+	_, _ = a.(*azureStorager).client.Create(context.Background(), nil)
+
+	testStorager(a, t)
+}
+
+func TestAzureSASPublicURL(t *testing.T) {
+	endpoint := "http://127.0.0.1:10000/devstoreaccount1"
+	if _, err := NewAzureSASStorager(endpoint, "devstoreaccount1", "sp=rwd&sig=write", "", "ipa-server", ""); err != ErrAzureReadSASRequired {
+		t.Fatalf("want ErrAzureReadSASRequired got %v", err)
+	}
+	a, err := NewAzureSASStorager(endpoint, "devstoreaccount1", "sp=rwd&sig=write", "?sp=r&sig=read", "ipa-server", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := a.PublicURL("", "a/b.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(u, "?sp=r&sig=read") || strings.Contains(u, "sig=write") {
+		t.Fatalf("public url not match: %s", u)
+	}
+}
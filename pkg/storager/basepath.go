@@ -3,6 +3,7 @@ package storager
 import (
 	"io"
 	"path/filepath"
+	"strings"
 )
 
 type basepathStorager struct {
@@ -32,6 +33,25 @@ func (b *basepathStorager) Move(src, dest string) error {
 	return b.s.Move(filepath.Join(b.base, src), filepath.Join(b.base, dest))
 }
 
+func (b *basepathStorager) List(prefix string) ([]string, error) {
+	base := filepath.ToSlash(filepath.Clean(b.base)) + "/"
+	list, err := b.s.List(base + prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, name := range list {
+		if strings.HasPrefix(name, base) {
+			names = append(names, strings.TrimPrefix(name, base))
+		}
+	}
+	return names, nil
+}
+
 func (b *basepathStorager) PublicURL(publicURL, name string) (string, error) {
 	return b.s.PublicURL(publicURL, filepath.Join(b.base, name))
 }
+
+func (b *basepathStorager) Proxied() bool {
+	return UseProxy(b.s)
+}
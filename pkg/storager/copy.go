@@ -0,0 +1,79 @@
+package storager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	ErrCopyVerifyFailed = errors.New("copy verify failed")
+)
+
+// Checksum size and sha256 of file
+type Checksum struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// read file and compute checksum
+func FileChecksum(s Storager, name string) (*Checksum, error) {
+	r, err := s.OpenMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return checksum(r)
+}
+
+func checksum(r io.Reader) (*Checksum, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return &Checksum{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Copy stream file between storagers, read back target to verify size and sha256
+func Copy(from, to Storager, name string) (*Checksum, error) {
+	r, err := from.OpenMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	cr := &countReader{r: io.TeeReader(r, h)}
+	if err := to.Save(name, cr); err != nil {
+		return nil, err
+	}
+	// drain reader in case storager not read to the end
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return nil, err
+	}
+	src := &Checksum{Size: cr.n, SHA256: hex.EncodeToString(h.Sum(nil))}
+
+	dest, err := FileChecksum(to, name)
+	if err != nil {
+		return nil, err
+	}
+	if *dest != *src {
+		return nil, fmt.Errorf("%w: %s source %d %s target %d %s", ErrCopyVerifyFailed, name, src.Size, src.SHA256, dest.Size, dest.SHA256)
+	}
+	return src, nil
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,40 @@
+package storager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// storager save truncated file
+type truncateStorager struct {
+	Storager
+}
+
+func (t *truncateStorager) Save(name string, reader io.Reader) error {
+	return t.Storager.Save(name, io.LimitReader(reader, 1))
+}
+
+func TestCopy(t *testing.T) {
+	from := NewMemStorager()
+	if err := from.Save("a/1.ipa", bytes.NewBufferString("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	to := NewMemStorager()
+	sum, err := Copy(from, to, "a/1.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Size != 5 || sum.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("checksum not match: %+v", sum)
+	}
+	if readString(to, "a/1.ipa") != "hello" {
+		t.Fatal("file not copied")
+	}
+
+	if _, err := Copy(from, &truncateStorager{NewMemStorager()}, "a/1.ipa"); !errors.Is(err, ErrCopyVerifyFailed) {
+		t.Fatalf("want ErrCopyVerifyFailed got %v", err)
+	}
+}
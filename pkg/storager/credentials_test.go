@@ -0,0 +1,110 @@
+package storager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// local metadata stub, first credentials expire soon
+func newCredentialsStub(t *testing.T, path string, creds func(n int32) interface{}) (*httptest.Server, *int32) {
+	count := int32(0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		n := atomic.AddInt32(&count, 1)
+		json.NewEncoder(w).Encode(creds(n))
+	}))
+	t.Cleanup(s.Close)
+	return s, &count
+}
+
+func TestAliOssRAMRoleCredentials(t *testing.T) {
+	stub, count := newCredentialsStub(t, "/latest/meta-data/ram/security-credentials/ipa", func(n int32) interface{} {
+		expiration := time.Now().Add(time.Minute)
+		if n > 1 {
+			expiration = time.Now().Add(time.Hour)
+		}
+		return map[string]interface{}{
+			"Code":            "Success",
+			"AccessKeyId":     "STS.id",
+			"AccessKeySecret": "secret",
+			"SecurityToken":   fmt.Sprintf("token%d", n),
+			"Expiration":      expiration.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+	})
+	defer func(endpoint string) { aliossMetadataEndpoint = endpoint }(aliossMetadataEndpoint)
+	aliossMetadataEndpoint = stub.URL
+
+	tokens := make(chan string, 10)
+	oss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens <- r.Header.Get("X-Oss-Security-Token")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer oss.Close()
+
+	s, err := NewAliOssStorager(oss.URL, "", "", "bucket", "", WithRAMRole("ipa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// first credentials expire within refresh window, refreshed on next request
+	for _, want := range []string{"token2", "token2"} {
+		if err := s.Delete("a.ipa"); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-tokens; got != want {
+			t.Fatalf("security token got %s want %s", got, want)
+		}
+	}
+	if n := atomic.LoadInt32(count); n != 2 {
+		t.Fatalf("metadata fetched %d times", n)
+	}
+
+	t.Setenv(aliossRAMRoleEnv, "")
+	t.Setenv(aliossCredentialsURIEnv, "")
+	if _, err := NewAliOssStorager(oss.URL, "", "", "bucket", ""); err != ErrAliOssCredentialsNotFound {
+		t.Fatalf("want ErrAliOssCredentialsNotFound got %v", err)
+	}
+}
+
+func TestS3AmbientCredentials(t *testing.T) {
+	stub, _ := newCredentialsStub(t, "/creds", func(n int32) interface{} {
+		return map[string]interface{}{
+			"AccessKeyId":     "AKID",
+			"SecretAccessKey": "secret",
+			"Token":           "token",
+			"Expiration":      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		}
+	})
+	for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", stub.URL+"/creds")
+
+	auth := make(chan string, 1)
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Authorization") + " " + r.Header.Get("X-Amz-Security-Token")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s3.Close()
+
+	s, err := NewS3Storager(s3.URL, "", "", "bucket", "", WithRegion("us-east-1"), WithPathStyle(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("a.ipa"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-auth; !strings.Contains(got, "Credential=AKID/") || !strings.HasSuffix(got, " token") {
+		t.Fatalf("request not signed with ambient credentials: %s", got)
+	}
+}
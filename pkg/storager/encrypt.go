@@ -0,0 +1,601 @@
+package storager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrKeyringEmpty     = errors.New("encryption keyring empty")
+	ErrKeyInvalid       = errors.New("encryption key must be base64 of 32 bytes")
+	ErrKeyNotFound      = errors.New("encryption key not found")
+	ErrCiphertextBroken = errors.New("ciphertext broken")
+	ErrEncryptVersion   = errors.New("encryption version not supported")
+	ErrPlainRejected    = errors.New("file not encrypted")
+)
+
+const (
+	// wrapped data keys of files encrypted by old versions, same path as file under this dir
+	EncryptKeyDir = ".ipa_encryption_keys"
+
+	// version 1 data key saved under EncryptKeyDir, version 2 saved in header of file
+	encryptVersion   = 2
+	encryptChunkSize = 64 << 10
+	// header of encrypted file: magic, big endian uint32 size of data key JSON, data key JSON
+	encryptMagic         = "IPAE"
+	encryptHeaderMaxSize = 4 << 10
+	// temp files of rewrap under EncryptKeyDir
+	encryptRewrapDir = ".rewrap"
+)
+
+// Keyring key encryption keys, first key is current key to wrap new data keys
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// LoadKeyring key file format, one key each line, first is current key:
+//
+//	ID:BASE64_OF_32_BYTES_KEY
+//
+// empty lines and lines start with # are ignored
+func LoadKeyring(name string) (*Keyring, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	k := &Keyring{keys: map[string][]byte{}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := strings.SplitN(line, ":", 2)
+		if len(r) != 2 {
+			return nil, ErrKeyInvalid
+		}
+		id := strings.TrimSpace(r[0])
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(r[1]))
+		if err != nil || len(key) != 32 || id == "" {
+			return nil, fmt.Errorf("%w: %s", ErrKeyInvalid, id)
+		}
+		if k.current == "" {
+			k.current = id
+		}
+		k.keys[id] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if k.current == "" {
+		return nil, ErrKeyringEmpty
+	}
+	return k, nil
+}
+
+// GenerateKey random key line of key file
+func GenerateKey(id string) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapped data key saved in header of file
+type dataKey struct {
+	Version int    `json:"version"`
+	KeyID   string `json:"keyId"`
+	// nonce and wrapped data key
+	Nonce []byte `json:"nonce"`
+	Key   []byte `json:"key"`
+	// base nonce of file chunks
+	DataNonce []byte `json:"dataNonce"`
+	ChunkSize int    `json:"chunkSize"`
+}
+
+func (k *Keyring) wrap(d *dataKey, plainKey []byte) error {
+	gcm, err := newGCM(k.keys[k.current])
+	if err != nil {
+		return err
+	}
+	d.KeyID = k.current
+	d.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(d.Nonce); err != nil {
+		return err
+	}
+	d.Key = gcm.Seal(nil, d.Nonce, plainKey, []byte(d.KeyID))
+	return nil
+}
+
+func (k *Keyring) unwrap(d *dataKey) ([]byte, error) {
+	kek, ok := k.keys[d.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, d.KeyID)
+	}
+	gcm, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, d.Nonce, d.Key, []byte(d.KeyID))
+}
+
+// EncryptStorager encrypt files with AES-GCM envelope encryption.
+// Each file has a random data key wrapped by key of keyring, files are encrypted in chunks to stream.
+// Files saved before encryption enabled are read as plain, unless SetRejectPlain.
+type EncryptStorager struct {
+	s    Storager
+	keys *Keyring
+	// refuse to read files without data key
+	rejectPlain bool
+	// data keys saved in EncryptKeyDir by old versions, nil if file has no data key
+	legacyLock sync.Mutex
+	legacyKeys map[string]*dataKey
+}
+
+var _ Storager = (*EncryptStorager)(nil)
+
+func NewEncryptStorager(store Storager, keys *Keyring) *EncryptStorager {
+	return &EncryptStorager{s: store, keys: keys, legacyKeys: map[string]*dataKey{}}
+}
+
+// SetRejectPlain refuse to read files not encrypted with ErrPlainRejected,
+// set after files saved before encryption enabled are all migrated
+func (e *EncryptStorager) SetRejectPlain(reject bool) {
+	e.rejectPlain = reject
+}
+
+func encryptKeyName(name string) string {
+	return filepath.Join(EncryptKeyDir, name)
+}
+
+func (e *EncryptStorager) loadDataKey(name string) (*dataKey, error) {
+	r, err := e.s.OpenMetadata(encryptKeyName(name))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	d := &dataKey{}
+	if err := json.NewDecoder(r).Decode(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// data key saved as separate file by old versions, nil if file has no data key.
+// result is cached, files saved by this version never have it
+func (e *EncryptStorager) legacyDataKey(name string) (*dataKey, error) {
+	e.legacyLock.Lock()
+	d, ok := e.legacyKeys[name]
+	e.legacyLock.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	keyName := filepath.ToSlash(encryptKeyName(name))
+	list, err := e.s.List(keyName)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range list {
+		if n == keyName {
+			if d, err = e.loadDataKey(name); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	e.legacyLock.Lock()
+	e.legacyKeys[name] = d
+	e.legacyLock.Unlock()
+	return d, nil
+}
+
+// forget cached data keys of files moved, deleted or rewrapped
+func (e *EncryptStorager) forgetLegacyDataKey(names ...string) {
+	e.legacyLock.Lock()
+	for _, name := range names {
+		delete(e.legacyKeys, name)
+	}
+	e.legacyLock.Unlock()
+}
+
+func (e *EncryptStorager) saveDataKey(name string, d *dataKey) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return e.s.Save(encryptKeyName(name), bytes.NewReader(b))
+}
+
+func encodeHeader(d *dataKey) ([]byte, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBufferString(encryptMagic)
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+	return buf.Bytes(), nil
+}
+
+// read header at start of file, data key is nil if file has no header.
+// return reader of data after header, or whole file if no header
+func readHeader(r io.Reader) (*dataKey, io.Reader, error) {
+	magic := make([]byte, len(encryptMagic))
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	if string(magic[:n]) != encryptMagic {
+		return nil, io.MultiReader(bytes.NewReader(magic[:n]), r), nil
+	}
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, nil, headerError(err)
+	}
+	if size > encryptHeaderMaxSize {
+		return nil, nil, ErrCiphertextBroken
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, nil, headerError(err)
+	}
+	d := &dataKey{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, nil, ErrCiphertextBroken
+	}
+	if d.Version != encryptVersion {
+		return nil, nil, fmt.Errorf("%w: %d", ErrEncryptVersion, d.Version)
+	}
+	return d, r, nil
+}
+
+func headerError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCiphertextBroken
+	}
+	return err
+}
+
+// nonce of chunk, base nonce xor chunk index
+func chunkNonce(base []byte, index uint64) []byte {
+	nonce := append([]byte{}, base...)
+	c := make([]byte, 8)
+	binary.BigEndian.PutUint64(c, index)
+	for i := range c {
+		nonce[len(nonce)-8+i] ^= c[i]
+	}
+	return nonce
+}
+
+// additional data of chunk, mark last chunk to detect truncation
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func (e *EncryptStorager) Save(name string, reader io.Reader) error {
+	plainKey := make([]byte, 32)
+	if _, err := rand.Read(plainKey); err != nil {
+		return err
+	}
+	gcm, err := newGCM(plainKey)
+	if err != nil {
+		return err
+	}
+	d := &dataKey{Version: encryptVersion, ChunkSize: encryptChunkSize, DataNonce: make([]byte, gcm.NonceSize())}
+	if _, err := rand.Read(d.DataNonce); err != nil {
+		return err
+	}
+	if err := e.keys.wrap(d, plainKey); err != nil {
+		return err
+	}
+	header, err := encodeHeader(d)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encryptChunks(pw, reader, gcm, d))
+	}()
+	// header saved with ciphertext, file is never left without data key
+	err = e.s.Save(name, io.MultiReader(bytes.NewReader(header), pr))
+	// stop encrypting if storager not read to the end
+	pr.CloseWithError(err)
+	return err
+}
+
+func encryptChunks(w io.Writer, r io.Reader, gcm cipher.AEAD, d *dataKey) error {
+	cur := make([]byte, d.ChunkSize)
+	next := make([]byte, d.ChunkSize)
+	n, err := io.ReadFull(r, cur)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := err != nil
+	for index := uint64(0); ; index++ {
+		// read ahead to know whether current chunk is the last
+		m := 0
+		if !last {
+			m, err = io.ReadFull(r, next)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			if m == 0 {
+				last = true
+			}
+		}
+		if _, err := w.Write(gcm.Seal(nil, chunkNonce(d.DataNonce, index), cur[:n], chunkAD(last))); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		last = m < d.ChunkSize
+		cur, next, n = next, cur, m
+	}
+}
+
+type decryptReader struct {
+	r     io.Reader
+	c     io.Closer
+	gcm   cipher.AEAD
+	d     *dataKey
+	index uint64
+	// current sealed chunk and next one read ahead to detect last chunk
+	buf  []byte
+	next []byte
+	// decrypted data not read
+	plain []byte
+	done  bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readChunk() error {
+	sealedSize := d.d.ChunkSize + d.gcm.Overhead()
+	if d.next == nil {
+		// first chunk
+		d.next = make([]byte, 0, sealedSize)
+		if err := d.fill(); err != nil {
+			return err
+		}
+	}
+	cur := append(d.buf[:0], d.next...)
+	d.buf = cur
+	d.next = d.next[:0]
+	last := len(cur) < sealedSize
+	if !last {
+		if err := d.fill(); err != nil {
+			return err
+		}
+		last = len(d.next) == 0
+	}
+	plain, err := d.gcm.Open(nil, chunkNonce(d.d.DataNonce, d.index), cur, chunkAD(last))
+	if err != nil {
+		return ErrCiphertextBroken
+	}
+	d.index++
+	d.plain = plain
+	d.done = last
+	return nil
+}
+
+// read next sealed chunk
+func (d *decryptReader) fill() error {
+	next := d.next[:cap(d.next)]
+	n, err := io.ReadFull(d.r, next)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	d.next = next[:n]
+	return nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.c.Close()
+}
+
+func (e *EncryptStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	f, err := e.s.OpenMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+	d, r, err := e.openDataKey(name, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if d == nil {
+		if e.rejectPlain {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s", ErrPlainRejected, name)
+		}
+		// NOTE: file saved before encryption enabled
+		return &struct {
+			io.Reader
+			io.Closer
+		}{r, f}, nil
+	}
+	plainKey, err := e.keys.unwrap(d)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	gcm, err := newGCM(plainKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &decryptReader{r: r, c: f, gcm: gcm, d: d}, nil
+}
+
+// data key of file from header, or from EncryptKeyDir if file encrypted by old versions.
+// data key is nil only if file is plain
+func (e *EncryptStorager) openDataKey(name string, f io.Reader) (*dataKey, io.Reader, error) {
+	d, r, err := readHeader(f)
+	if err != nil || d != nil {
+		return d, r, err
+	}
+	d, err = e.legacyDataKey(name)
+	return d, r, err
+}
+
+func (e *EncryptStorager) Delete(name string) error {
+	if err := e.s.Delete(name); err != nil {
+		return err
+	}
+	// NOTE: ignore error, only files encrypted by old versions have key file
+	_ = e.s.Delete(encryptKeyName(name))
+	e.forgetLegacyDataKey(name)
+	return nil
+}
+
+func (e *EncryptStorager) Move(src, dest string) error {
+	if err := e.s.Move(src, dest); err != nil {
+		return err
+	}
+	defer e.forgetLegacyDataKey(src, dest)
+	// data key saved in header moved with file
+	d, err := e.legacyDataKey(src)
+	if err != nil || d == nil {
+		return err
+	}
+	if err := e.saveDataKey(dest, d); err != nil {
+		return err
+	}
+	return e.s.Delete(encryptKeyName(src))
+}
+
+// List files without wrapped data keys
+func (e *EncryptStorager) List(prefix string) ([]string, error) {
+	list, err := e.s.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, name := range list {
+		// wrapped data keys and temp files of rewrap
+		if !strings.HasPrefix(name, EncryptKeyDir+"/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Unwrap storager saving encrypted files
+func (e *EncryptStorager) Unwrap() Storager {
+	return e.s
+}
+
+// WithKeyNames append names of wrapped data keys of files encrypted by old versions to names,
+// to copy or repair encrypted files in underlying storager
+func (e *EncryptStorager) WithKeyNames(names []string) []string {
+	list := append([]string{}, names...)
+	for _, name := range names {
+		list = append(list, encryptKeyName(name))
+	}
+	return list
+}
+
+// encrypted files can not be served by storager, download over server proxy route
+func (e *EncryptStorager) PublicURL(publicURL, name string) (string, error) {
+	return ProxyURL(publicURL, name)
+}
+
+// Proxied files decrypted by server, always downloaded over proxy route
+func (e *EncryptStorager) Proxied() bool {
+	return true
+}
+
+// Rewrap data key of file with current key, file rewritten with new header, ciphertext is not changed.
+// Files encrypted by old versions are rewritten with data key in header.
+// Return false if file not encrypted or already use current key
+func (e *EncryptStorager) Rewrap(name string) (bool, error) {
+	f, err := e.s.OpenMetadata(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	d, r, err := readHeader(f)
+	if err != nil {
+		return false, err
+	}
+	legacy := d == nil
+	if legacy {
+		if d, err = e.legacyDataKey(name); err != nil || d == nil {
+			return false, err
+		}
+	} else if d.KeyID == e.keys.current {
+		return false, nil
+	}
+	plainKey, err := e.keys.unwrap(d)
+	if err != nil {
+		return false, err
+	}
+	if err := e.keys.wrap(d, plainKey); err != nil {
+		return false, err
+	}
+	d.Version = encryptVersion
+	header, err := encodeHeader(d)
+	if err != nil {
+		return false, err
+	}
+
+	// replace file after new file saved
+	temp := filepath.Join(EncryptKeyDir, encryptRewrapDir, name)
+	if err := e.s.Save(temp, io.MultiReader(bytes.NewReader(header), r)); err != nil {
+		e.s.Delete(temp)
+		return false, err
+	}
+	f.Close()
+	if err := e.s.Move(temp, name); err != nil {
+		e.s.Delete(temp)
+		return false, err
+	}
+	if legacy {
+		e.forgetLegacyDataKey(name)
+		return true, e.s.Delete(encryptKeyName(name))
+	}
+	return true, nil
+}
@@ -0,0 +1,277 @@
+package storager
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeyFile(t *testing.T, ids ...string) string {
+	lines := []string{"# test keys"}
+	for _, id := range ids {
+		line, err := GenerateKey(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	name := filepath.Join(t.TempDir(), "keys")
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestEncryptStorager(t *testing.T) {
+	keys, err := LoadKeyring(writeKeyFile(t, "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemStorager()
+	e := NewEncryptStorager(mem, keys)
+
+	testStorager(e, t)
+
+	for _, size := range []int{0, 1, encryptChunkSize - 1, encryptChunkSize, encryptChunkSize + 1, 3*encryptChunkSize + 7} {
+		data := make([]byte, size)
+		rand.Read(data)
+		if err := e.Save("a.ipa", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if got := readString(e, "a.ipa"); got != string(data) {
+			t.Fatalf("size %d: decrypted data not match", size)
+		}
+		// short data may appear in header or ciphertext by chance
+		if size >= 16 && strings.Contains(readString(mem, "a.ipa"), string(data)) {
+			t.Fatalf("size %d: plain data saved", size)
+		}
+	}
+
+	// data key saved in header, moved with file
+	if readString(mem, encryptKeyName("a.ipa")) != "" {
+		t.Fatal("data key saved as separate file")
+	}
+	if err := e.Move("a.ipa", "b.ipa"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(e, "b.ipa"); len(got) != 3*encryptChunkSize+7 {
+		t.Fatal("moved file not decrypted")
+	}
+	if err := e.Delete("b.ipa"); err != nil {
+		t.Fatal(err)
+	}
+
+	// files saved before encryption enabled are read as plain
+	mem.Save("plain.ipa", bytes.NewBufferString("plain"))
+	if got := readString(e, "plain.ipa"); got != "plain" {
+		t.Fatalf("want plain got %s", got)
+	}
+	e.SetRejectPlain(true)
+	if _, err := e.OpenMetadata("plain.ipa"); !errors.Is(err, ErrPlainRejected) {
+		t.Fatalf("want ErrPlainRejected got %v", err)
+	}
+	e.Save("c.ipa", bytes.NewBufferString("c"))
+	if got := readString(e, "c.ipa"); got != "c" {
+		t.Fatalf("want c got %s", got)
+	}
+	e.SetRejectPlain(false)
+
+	u, err := e.PublicURL("https://example.com", "c.ipa")
+	if err != nil || u != "https://example.com"+ProxyPath+"c.ipa" {
+		t.Fatalf("want proxy url got %s %v", u, err)
+	}
+}
+
+func TestEncryptStoragerBroken(t *testing.T) {
+	keys, err := LoadKeyring(writeKeyFile(t, "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemStorager()
+	e := NewEncryptStorager(mem, keys)
+	data := make([]byte, 2*encryptChunkSize+1)
+	if err := e.Save("a.ipa", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	sealed := []byte(readString(mem, "a.ipa"))
+	header := len(sealed) - (len(data) + 3*16)
+
+	// truncated at chunk boundary
+	mem.Save("a.ipa", bytes.NewReader(sealed[:header+encryptChunkSize+16]))
+	r, _ := e.OpenMetadata("a.ipa")
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrCiphertextBroken) {
+		t.Fatalf("want ErrCiphertextBroken got %v", err)
+	}
+
+	// truncated header never read as plain
+	mem.Save("a.ipa", bytes.NewReader(sealed[:header-1]))
+	if _, err := e.OpenMetadata("a.ipa"); !errors.Is(err, ErrCiphertextBroken) {
+		t.Fatalf("want ErrCiphertextBroken got %v", err)
+	}
+
+	// tampered
+	sealed[header+10] ^= 1
+	mem.Save("a.ipa", bytes.NewReader(sealed))
+	r, _ = e.OpenMetadata("a.ipa")
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrCiphertextBroken) {
+		t.Fatalf("want ErrCiphertextBroken got %v", err)
+	}
+}
+
+// save file as old versions, data key saved under EncryptKeyDir
+func saveLegacy(t *testing.T, mem Storager, keys *Keyring, name, data string) {
+	if err := NewEncryptStorager(mem, keys).Save(name, bytes.NewBufferString(data)); err != nil {
+		t.Fatal(err)
+	}
+	d, r, err := readHeader(bytes.NewBufferString(readString(mem, name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Version = 1
+	mem.Save(name, r)
+	if err := NewEncryptStorager(mem, keys).saveDataKey(name, d); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptStoragerLegacy(t *testing.T) {
+	keys, err := LoadKeyring(writeKeyFile(t, "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemStorager()
+	e := NewEncryptStorager(mem, keys)
+	saveLegacy(t, mem, keys, "a.ipa", "data")
+	if got := readString(e, "a.ipa"); got != "data" {
+		t.Fatalf("want data got %s", got)
+	}
+
+	// move with data key
+	if err := e.Move("a.ipa", "b.ipa"); err != nil {
+		t.Fatal(err)
+	}
+	if readString(mem, encryptKeyName("a.ipa")) != "" || readString(mem, encryptKeyName("b.ipa")) == "" {
+		t.Fatal("data key not moved")
+	}
+
+	// rewrap save data key in header
+	if ok, err := e.Rewrap("b.ipa"); !ok || err != nil {
+		t.Fatalf("want rewrapped got %v %v", ok, err)
+	}
+	if readString(mem, encryptKeyName("b.ipa")) != "" {
+		t.Fatal("data key not removed")
+	}
+	if got := readString(e, "b.ipa"); got != "data" {
+		t.Fatalf("want data got %s", got)
+	}
+	if names, _ := e.List(""); len(names) != 1 {
+		t.Fatalf("temp file of rewrap left: %v", names)
+	}
+
+	// broken data key never read as plain
+	mem.Save(encryptKeyName("b.ipa"), bytes.NewBufferString("broken"))
+	if _, err := e.OpenMetadata("b.ipa"); err != nil {
+		t.Fatalf("data key in header used first: %v", err)
+	}
+	saveLegacy(t, mem, keys, "c.ipa", "data")
+	mem.Save(encryptKeyName("c.ipa"), bytes.NewBufferString("broken"))
+	if _, err := e.OpenMetadata("c.ipa"); err == nil {
+		t.Fatal("file with broken data key read as plain")
+	}
+}
+
+func TestEncryptStoragerRewrap(t *testing.T) {
+	oldFile := writeKeyFile(t, "k1")
+	oldKeys, err := LoadKeyring(oldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemStorager()
+	if err := NewEncryptStorager(mem, oldKeys).Save("a.ipa", bytes.NewBufferString("data")); err != nil {
+		t.Fatal(err)
+	}
+	// ciphertext after header
+	body := func() string {
+		_, r, err := readHeader(bytes.NewBufferString(readString(mem, "a.ipa")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(r)
+		return string(b)
+	}
+	sealed := body()
+
+	// new key first, keep old key
+	line, _ := GenerateKey("k2")
+	old, _ := ioutil.ReadFile(oldFile)
+	newFile := filepath.Join(t.TempDir(), "keys")
+	ioutil.WriteFile(newFile, []byte(line+"\n"+string(old)), 0600)
+	keys, err := LoadKeyring(newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEncryptStorager(mem, keys)
+	if ok, err := e.Rewrap("a.ipa"); !ok || err != nil {
+		t.Fatalf("want rewrapped got %v %v", ok, err)
+	}
+	if ok, err := e.Rewrap("a.ipa"); ok || err != nil {
+		t.Fatalf("want skipped got %v %v", ok, err)
+	}
+	if body() != sealed {
+		t.Fatal("data encrypted again")
+	}
+
+	// old key removed
+	ioutil.WriteFile(newFile, []byte(line), 0600)
+	keys, err = LoadKeyring(newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(NewEncryptStorager(mem, keys), "a.ipa"); got != "data" {
+		t.Fatalf("want data got %s", got)
+	}
+	if _, err := NewEncryptStorager(mem, oldKeys).OpenMetadata("a.ipa"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("want ErrKeyNotFound got %v", err)
+	}
+}
+
+type listCountStorager struct {
+	Storager
+	count int
+}
+
+func (l *listCountStorager) List(prefix string) ([]string, error) {
+	l.count++
+	return l.Storager.List(prefix)
+}
+
+func TestEncryptStoragerLegacyCache(t *testing.T) {
+	keys, err := LoadKeyring(writeKeyFile(t, "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := &listCountStorager{Storager: NewMemStorager()}
+	e := NewEncryptStorager(mem, keys)
+	saveLegacy(t, mem.Storager, keys, "a.ipa", "data")
+	mem.Save("plain.ipa", bytes.NewBufferString("plain"))
+	for i := 0; i < 3; i++ {
+		if readString(e, "a.ipa") != "data" || readString(e, "plain.ipa") != "plain" {
+			t.Fatal("data not match")
+		}
+	}
+	if mem.count != 2 {
+		t.Fatalf("data key looked up %d times", mem.count)
+	}
+
+	// moved data key looked up again
+	if err := e.Move("a.ipa", "b.ipa"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readString(e, "b.ipa"); got != "data" {
+		t.Fatalf("want data got %s", got)
+	}
+}
@@ -0,0 +1,105 @@
+package storager
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"github.com/iineva/ipa-server/pkg/storager/helper"
+)
+
+type gcsStorager struct {
+	client  *storage.Client
+	bucket  *storage.BucketHandle
+	domain  string
+	options *options
+}
+
+var _ Storager = (*gcsStorager)(nil)
+
+// endpoint: empty to use default endpoint, http://localhost:4443/storage/v1/ for fake-gcs-server
+// credentials: service account JSON key file, empty to use application default credentials,
+// or no authentication if endpoint is set
+// domain: public url of bucket, empty for private bucket to use signed url
+func NewGCSStorager(endpoint, credentials, bucket, domain string, opts ...Option) (Storager, error) {
+	clientOpts := []option.ClientOption{}
+	if endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoint))
+	}
+	if credentials != "" {
+		clientOpts = append(clientOpts, option.WithCredentialsFile(credentials))
+	} else if endpoint != "" {
+		clientOpts = append(clientOpts, option.WithoutAuthentication())
+	}
+	client, err := storage.NewClient(context.Background(), clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsStorager{client: client, bucket: client.Bucket(bucket), domain: domain, options: newOptions(opts)}, nil
+}
+
+func (g *gcsStorager) Save(name string, reader io.Reader) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := g.bucket.Object(name).NewWriter(ctx)
+	w.PredefinedACL = g.options.acl
+	w.StorageClass = g.options.storageClass
+	if _, err := io.Copy(w, reader); err != nil {
+		// cancel context to abort upload
+		cancel()
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (g *gcsStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	return g.bucket.Object(name).NewReader(context.Background())
+}
+
+func (g *gcsStorager) Delete(name string) error {
+	return g.bucket.Object(name).Delete(context.Background())
+}
+
+func (g *gcsStorager) Move(src, dest string) error {
+	// Copier use rewrite API, large object will be copied with multiple requests
+	c := g.bucket.Object(dest).CopierFrom(g.bucket.Object(src))
+	c.PredefinedACL = g.options.acl
+	c.StorageClass = g.options.storageClass
+	_, err := c.Run(context.Background())
+	if err != nil {
+		return err
+	}
+	return g.Delete(src)
+}
+
+func (g *gcsStorager) List(prefix string) ([]string, error) {
+	names := []string{}
+	it := g.bucket.Objects(context.Background(), &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, attrs.Name)
+	}
+}
+
+func (g *gcsStorager) PublicURL(_, name string) (string, error) {
+	if g.domain != "" && g.options.signedURLExpiry == 0 {
+		return helper.UrlJoin(g.domain, name)
+	}
+	return g.bucket.SignedURL(name, &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(gcsSignedURLExpiry(g.options.expiry())),
+	})
+}
@@ -0,0 +1,289 @@
+package storager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iineva/ipa-server/pkg/storager/helper"
+)
+
+// gcsHMACStorager use GCS XML API with HMAC keys, requests are signed with V4 signature
+type gcsHMACStorager struct {
+	endpoint *url.URL
+	accessID string
+	secret   string
+	bucket   string
+	domain   string
+	client   *http.Client
+	options  *options
+}
+
+var _ Storager = (*gcsHMACStorager)(nil)
+
+const (
+	gcsDefaultEndpoint = "https://storage.googleapis.com"
+	gcsHMACAlgorithm   = "GOOG4-HMAC-SHA256"
+	gcsHMACRegion      = "auto"
+	// expiry of signed requests send to GCS
+	gcsRequestExpiry = 15 * time.Minute
+	// max expiry of V4 signed url
+	gcsMaxSignedURLExpiry = 7 * 24 * time.Hour
+)
+
+// expiry of V4 signed url, GCS refuse url expire after 7 days
+func gcsSignedURLExpiry(expiry time.Duration) time.Duration {
+	if expiry > gcsMaxSignedURLExpiry {
+		return gcsMaxSignedURLExpiry
+	}
+	return expiry
+}
+
+// endpoint: empty to use https://storage.googleapis.com
+// domain: public url of bucket, empty for private bucket to use signed url
+func NewGCSHMACStorager(endpoint, accessID, secret, bucket, domain string, opts ...Option) (Storager, error) {
+	if endpoint == "" {
+		endpoint = gcsDefaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		u, err = url.Parse("https://" + endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &gcsHMACStorager{
+		endpoint: u,
+		accessID: accessID,
+		secret:   secret,
+		bucket:   bucket,
+		domain:   domain,
+		client:   &http.Client{},
+		options:  newOptions(opts),
+	}, nil
+}
+
+// sign URL with V4 signature
+// https://cloud.google.com/storage/docs/access-control/signing-urls-manually
+// query: extra query parameters to sign with request
+func (g *gcsHMACStorager) signURL(method, name string, query, headers map[string]string, expires time.Duration) string {
+	now := time.Now().UTC()
+	datetime := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/storage/goog4_request", date, gcsHMACRegion)
+
+	// canonical headers
+	h := map[string]string{"host": g.endpoint.Host}
+	for k, v := range headers {
+		h[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	canonicalHeaders := ""
+	for _, k := range keys {
+		canonicalHeaders += k + ":" + h[k] + "\n"
+	}
+	signedHeaders := strings.Join(keys, ";")
+
+	// canonical query
+	q := map[string]string{
+		"X-Goog-Algorithm":     gcsHMACAlgorithm,
+		"X-Goog-Credential":    g.accessID + "/" + scope,
+		"X-Goog-Date":          datetime,
+		"X-Goog-Expires":       fmt.Sprintf("%d", int64(gcsSignedURLExpiry(expires)/time.Second)),
+		"X-Goog-SignedHeaders": signedHeaders,
+	}
+	for k, v := range query {
+		q[k] = v
+	}
+	qk := make([]string, 0, len(q))
+	for k := range q {
+		qk = append(qk, k)
+	}
+	sort.Strings(qk)
+	pairs := []string{}
+	for _, k := range qk {
+		pairs = append(pairs, gcsURIEncode(k, true)+"="+gcsURIEncode(q[k], true))
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	p := strings.TrimSuffix(g.endpoint.EscapedPath(), "/") + "/" + gcsURIEncode(g.bucket, true)
+	if name != "" {
+		p += "/" + gcsURIEncode(name, false)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		p,
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		gcsHMACAlgorithm,
+		datetime,
+		scope,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+
+	key := gcsHMAC([]byte("GOOG4"+g.secret), date)
+	key = gcsHMAC(key, gcsHMACRegion)
+	key = gcsHMAC(key, "storage")
+	key = gcsHMAC(key, "goog4_request")
+	signature := hex.EncodeToString(gcsHMAC(key, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Goog-Signature=%s", g.endpoint.Scheme, g.endpoint.Host, p, canonicalQuery, signature)
+}
+
+func (g *gcsHMACStorager) do(method, name string, query, headers map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, g.signURL(method, name, query, headers, gcsRequestExpiry), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("gcs %s %s: %s %s", method, name, resp.Status, string(b))
+	}
+	return resp, nil
+}
+
+// headers to set ACL and storage class of saved objects
+func (g *gcsHMACStorager) objectHeaders() map[string]string {
+	h := map[string]string{}
+	if g.options.acl != "" {
+		h["x-goog-acl"] = g.options.acl
+	}
+	if g.options.storageClass != "" {
+		h["x-goog-storage-class"] = g.options.storageClass
+	}
+	return h
+}
+
+func (g *gcsHMACStorager) Save(name string, reader io.Reader) error {
+	// avoid http client to close reader
+	resp, err := g.do(http.MethodPut, name, nil, g.objectHeaders(), ioutil.NopCloser(reader))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (g *gcsHMACStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	resp, err := g.do(http.MethodGet, name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (g *gcsHMACStorager) Delete(name string) error {
+	resp, err := g.do(http.MethodDelete, name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Move copy with XML API in one request, same ACL and storage class as Save.
+// HMAC keys are not accepted by JSON API, rewrite API used by service account is not available,
+// copy of large object between locations or storage classes may fail, use service account for it
+func (g *gcsHMACStorager) Move(src, dest string) error {
+	h := g.objectHeaders()
+	h["x-goog-copy-source"] = "/" + gcsURIEncode(g.bucket, true) + "/" + gcsURIEncode(src, false)
+	resp, err := g.do(http.MethodPut, dest, nil, h, nil)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return err
+	}
+	return g.Delete(src)
+}
+
+// XML API list objects, https://cloud.google.com/storage/docs/xml-api/get-bucket-list
+func (g *gcsHMACStorager) List(prefix string) ([]string, error) {
+	names := []string{}
+	token := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": prefix}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+		resp, err := g.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		ret := struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}{}
+		err = xml.NewDecoder(resp.Body).Decode(&ret)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range ret.Contents {
+			names = append(names, c.Key)
+		}
+		if !ret.IsTruncated || ret.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = ret.NextContinuationToken
+	}
+}
+
+func (g *gcsHMACStorager) PublicURL(_, name string) (string, error) {
+	if g.domain != "" && g.options.signedURLExpiry == 0 {
+		return helper.UrlJoin(g.domain, name)
+	}
+	return g.signURL(http.MethodGet, name, nil, nil, g.options.expiry()), nil
+}
+
+func gcsHMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// percent encode all characters except unreserved ones, keep "/" if not encodeSlash
+func gcsURIEncode(s string, encodeSlash bool) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
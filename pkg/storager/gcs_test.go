@@ -0,0 +1,46 @@
+package storager
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// run fake-gcs-server first:
+// docker run -p 4443:4443 fsouza/fake-gcs-server -scheme http
+func TestGCS(t *testing.T) {
+
+	endpoint := "http://localhost:4443/storage/v1/"
+	credentials := ""
+	bucketName := "ipa-server"
+	domain := "http://localhost:4443/ipa-server"
+
+	g, err := NewGCSStorager(endpoint, credentials, bucketName, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fail fast if emulator not running
+	gs := g.(*gcsStorager)
+	gs.bucket = gs.bucket.Retryer(storage.WithPolicy(storage.RetryNever))
+	// NOTE: ignore error, bucket may already exist
+	_ = gs.bucket.Create(context.Background(), "test", nil)
+
+	testStorager(g, t)
+}
+
+func TestGCSHMACSignedURLExpiry(t *testing.T) {
+	g, err := NewGCSHMACStorager("", "GOOG1ID", "secret", "ipa-server", "", WithSignedURL(30*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := g.PublicURL("", "a b.ipa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(u, "X-Goog-Expires=604800&") || !strings.HasPrefix(u, "https://storage.googleapis.com/ipa-server/a%20b.ipa?") {
+		t.Fatalf("signed url not match: %s", u)
+	}
+}
@@ -0,0 +1,45 @@
+package storager
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	keys, err := LoadKeyring(writeKeyFile(t, "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Storager{
+		"mem":      NewMemStorager(),
+		"os":       NewOsFileStorager(t.TempDir()),
+		"basepath": NewBasePathStorager("ipa", NewMemStorager()),
+		"encrypt":  NewEncryptStorager(NewMemStorager(), keys),
+	}
+	for kind, s := range stores {
+		for _, name := range []string{"appList.json", "a/1.ipa", "a/1.png", "ab/2.ipa", ".ipa_parser_temp/x"} {
+			if err := s.Save(name, bytes.NewBufferString(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cases := map[string]string{
+			"":                  ".ipa_parser_temp/x a/1.ipa a/1.png ab/2.ipa appList.json",
+			"a/":                "a/1.ipa a/1.png",
+			"a":                 "a/1.ipa a/1.png ab/2.ipa appList.json",
+			".ipa_parser_temp/": ".ipa_parser_temp/x",
+			"none/":             "",
+		}
+		for prefix, want := range cases {
+			names, err := s.List(prefix)
+			if err != nil {
+				t.Fatalf("%s list %q: %v", kind, prefix, err)
+			}
+			sort.Strings(names)
+			if got := strings.Join(names, " "); got != want {
+				t.Fatalf("%s list %q: want %q got %q", kind, prefix, want, got)
+			}
+		}
+	}
+}
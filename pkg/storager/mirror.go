@@ -0,0 +1,283 @@
+package storager
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	ErrMirrorFileMissing = errors.New("file missing from all tiers")
+)
+
+// MirrorStorager save files to primary and mirrors, read from preferred tier first and fall back to others.
+// Files failed to write to mirror are remembered and copied again by Repair.
+type MirrorStorager struct {
+	// tiers[0] is primary
+	tiers     []Storager
+	preferred int
+
+	lock sync.Mutex
+	// names known of each tier, true if saved, false if missing, unknown names are checked by List
+	known []map[string]bool
+}
+
+var _ Storager = (*MirrorStorager)(nil)
+
+// preferred: index of tier to read and serve public url, 0 is primary, 1 is first mirror
+func NewMirrorStorager(preferred int, primary Storager, mirrors ...Storager) *MirrorStorager {
+	tiers := append([]Storager{primary}, mirrors...)
+	if preferred < 0 || preferred >= len(tiers) {
+		preferred = 0
+	}
+	known := make([]map[string]bool, len(tiers))
+	for i := range known {
+		known[i] = map[string]bool{}
+	}
+	return &MirrorStorager{tiers: tiers, preferred: preferred, known: known}
+}
+
+func (m *MirrorStorager) setMissing(tier int, name string, missing bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.known[tier][name] = !missing
+}
+
+// forget name of tier, checked again when needed
+func (m *MirrorStorager) forget(tier int, name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.known[tier], name)
+}
+
+func (m *MirrorStorager) isMissing(tier int, name string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	saved, ok := m.known[tier][name]
+	return ok && !saved
+}
+
+// check file saved to tier by List if unknown, files saved before restart are unknown
+func (m *MirrorStorager) isSaved(tier int, name string) (bool, error) {
+	m.lock.Lock()
+	saved, ok := m.known[tier][name]
+	m.lock.Unlock()
+	if ok {
+		return saved, nil
+	}
+	list, err := m.tiers[tier].List(name)
+	if err != nil {
+		return false, err
+	}
+	saved = false
+	for _, n := range list {
+		if n == name {
+			saved = true
+			break
+		}
+	}
+	m.setMissing(tier, name, !saved)
+	return saved, nil
+}
+
+// tiers index to read, preferred first
+func (m *MirrorStorager) readOrder() []int {
+	order := []int{m.preferred}
+	for i := range m.tiers {
+		if i != m.preferred {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// copy file from tier to tier
+func (m *MirrorStorager) copy(name string, from, to int) error {
+	r, err := m.tiers[from].OpenMetadata(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return m.tiers[to].Save(name, r)
+}
+
+func (m *MirrorStorager) Save(name string, reader io.Reader) error {
+	if err := m.tiers[0].Save(name, reader); err != nil {
+		return err
+	}
+	m.setMissing(0, name, false)
+	// copy to mirrors from primary, failed mirrors will be repaired later
+	for i := 1; i < len(m.tiers); i++ {
+		m.setMissing(i, name, m.copy(name, 0, i) != nil)
+	}
+	return nil
+}
+
+func (m *MirrorStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	var lastErr error
+	for _, i := range m.readOrder() {
+		if m.isMissing(i, name) {
+			continue
+		}
+		r, err := m.tiers[i].OpenMetadata(name)
+		if err == nil {
+			return r, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = ErrMirrorFileMissing
+	}
+	return nil, lastErr
+}
+
+func (m *MirrorStorager) Delete(name string) error {
+	err := m.tiers[0].Delete(name)
+	for i := 1; i < len(m.tiers); i++ {
+		if m.isMissing(i, name) {
+			continue
+		}
+		// NOTE: ignore error of mirrors
+		m.tiers[i].Delete(name)
+	}
+	for i := range m.tiers {
+		m.forget(i, name)
+	}
+	return err
+}
+
+func (m *MirrorStorager) Move(src, dest string) error {
+	if err := m.tiers[0].Move(src, dest); err != nil {
+		return err
+	}
+	m.forget(0, src)
+	m.setMissing(0, dest, false)
+	for i := 1; i < len(m.tiers); i++ {
+		failed := m.isMissing(i, src) || m.tiers[i].Move(src, dest) != nil
+		m.forget(i, src)
+		m.setMissing(i, dest, failed)
+	}
+	return nil
+}
+
+// List files of all tiers, file missing from primary but saved to mirrors is listed too
+func (m *MirrorStorager) List(prefix string) ([]string, error) {
+	names, err := m.tiers[0].List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	for i := 1; i < len(m.tiers); i++ {
+		list, err := m.tiers[i].List(prefix)
+		if err != nil {
+			// NOTE: ignore error of mirrors
+			continue
+		}
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// PublicURL of the first tier file saved to, preferred first
+func (m *MirrorStorager) PublicURL(publicURL, name string) (string, error) {
+	var lastErr error
+	for _, i := range m.readOrder() {
+		saved, err := m.isSaved(i, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !saved {
+			continue
+		}
+		u, err := m.tiers[i].PublicURL(publicURL, name)
+		if err == nil {
+			return u, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = ErrMirrorFileMissing
+	}
+	return "", lastErr
+}
+
+// Proxied true if any tier download files over proxy route
+func (m *MirrorStorager) Proxied() bool {
+	for _, t := range m.tiers {
+		if UseProxy(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MirrorStorager) exists(tier int, name string) bool {
+	r, err := m.tiers[tier].OpenMetadata(name)
+	if err != nil {
+		return false
+	}
+	r.Close()
+	return true
+}
+
+// Repair copy files missing from any tier, names: files should exist, files failed to write before are always checked.
+// Return count of copied files and first error.
+func (m *MirrorStorager) Repair(names []string) (int, error) {
+	m.lock.Lock()
+	check := map[string]bool{}
+	for _, known := range m.known {
+		for name, saved := range known {
+			if !saved {
+				check[name] = true
+			}
+		}
+	}
+	m.lock.Unlock()
+	for _, name := range names {
+		check[name] = true
+	}
+
+	repaired := 0
+	var firstErr error
+	for name := range check {
+		// tiers which have the file
+		sources := []int{}
+		targets := []int{}
+		for i := range m.tiers {
+			if !m.isMissing(i, name) && m.exists(i, name) {
+				sources = append(sources, i)
+				m.setMissing(i, name, false)
+			} else {
+				targets = append(targets, i)
+			}
+		}
+		if len(sources) == 0 {
+			// file deleted or lost from all tiers
+			for _, i := range targets {
+				m.forget(i, name)
+			}
+			continue
+		}
+		for _, i := range targets {
+			if err := m.copy(name, sources[0], i); err != nil {
+				m.setMissing(i, name, true)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			m.setMissing(i, name, false)
+			repaired++
+		}
+	}
+	return repaired, firstErr
+}
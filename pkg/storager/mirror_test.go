@@ -0,0 +1,129 @@
+package storager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// storager can be switched offline
+type flakyStorager struct {
+	Storager
+	offline bool
+}
+
+var errOffline = errors.New("offline")
+
+func (f *flakyStorager) Save(name string, reader io.Reader) error {
+	if f.offline {
+		return errOffline
+	}
+	return f.Storager.Save(name, reader)
+}
+
+func (f *flakyStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	if f.offline {
+		return nil, errOffline
+	}
+	return f.Storager.OpenMetadata(name)
+}
+
+func (f *flakyStorager) Move(src, dest string) error {
+	if f.offline {
+		return errOffline
+	}
+	return f.Storager.Move(src, dest)
+}
+
+func readString(s Storager, name string) string {
+	r, err := s.OpenMetadata(name)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+	b, _ := ioutil.ReadAll(r)
+	return string(b)
+}
+
+func TestMirrorStorager(t *testing.T) {
+	primary := NewMemStorager()
+	mirror := &flakyStorager{Storager: NewMemStorager()}
+	m := NewMirrorStorager(1, primary, mirror)
+
+	testStorager(m, t)
+
+	if err := m.Save("a/tmp", bytes.NewBufferString("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Move("a/tmp", "a/1.ipa"); err != nil {
+		t.Fatal(err)
+	}
+	if readString(primary, "a/1.ipa") != "a" || readString(mirror, "a/1.ipa") != "a" {
+		t.Fatal("file not mirrored")
+	}
+
+	// mirror offline, save to primary only and read fall back to primary
+	mirror.offline = true
+	if err := m.Save("b/1.ipa", bytes.NewBufferString("b")); err != nil {
+		t.Fatal(err)
+	}
+	if readString(m, "a/1.ipa") != "a" || readString(m, "b/1.ipa") != "b" {
+		t.Fatal("read not fall back to primary")
+	}
+	if u, _ := m.PublicURL("https://example.com", "b/1.ipa"); u != "https://example.com/b/1.ipa" {
+		t.Fatalf("public url not fall back: %s", u)
+	}
+
+	// repair missing file when mirror back online
+	mirror.offline = false
+	if readString(mirror, "b/1.ipa") != "" {
+		t.Fatal("file should missing from mirror")
+	}
+	// lost from primary
+	if err := primary.Delete("a/1.ipa"); err != nil {
+		t.Fatal(err)
+	}
+	// list files of all tiers
+	if names, err := m.List("a/"); err != nil || len(names) != 1 || names[0] != "a/1.ipa" {
+		t.Fatalf("list not match: %v %v", names, err)
+	}
+	n, err := m.Repair([]string{"a/1.ipa", "c/1.ipa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || readString(mirror, "b/1.ipa") != "b" || readString(primary, "a/1.ipa") != "a" {
+		t.Fatalf("repair failed, repaired %d", n)
+	}
+	if n, _ := m.Repair(nil); n != 0 {
+		t.Fatalf("nothing to repair, repaired %d", n)
+	}
+
+	if err := m.Delete("b/1.ipa"); err != nil {
+		t.Fatal(err)
+	}
+	if readString(mirror, "b/1.ipa") != "" {
+		t.Fatal("file not deleted from mirror")
+	}
+}
+
+func TestMirrorStoragerPublicURLAfterRestart(t *testing.T) {
+	primary := NewMemStorager()
+	mirror := &proxyStorager{Storager: NewMemStorager(), domain: "https://cdn.example.com"}
+	if err := primary.Save("a/1.ipa", bytes.NewBufferString("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	// file missing from preferred mirror not known after restart
+	m := NewMirrorStorager(1, primary, mirror)
+	if u, _ := m.PublicURL("https://example.com", "a/1.ipa"); u != "https://example.com/a/1.ipa" {
+		t.Fatalf("public url not fall back: %s", u)
+	}
+	if n, err := m.Repair(nil); err != nil || n != 1 {
+		t.Fatalf("missing file found by public url not repaired: %d %v", n, err)
+	}
+	if u, _ := m.PublicURL("https://example.com", "a/1.ipa"); u != "https://cdn.example.com/a/1.ipa" {
+		t.Fatalf("public url not use preferred tier: %s", u)
+	}
+}
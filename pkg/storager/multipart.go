@@ -0,0 +1,139 @@
+package storager
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// upload in parts if size of file larger than threshold
+	DefaultMultipartThreshold = 64 << 20
+	DefaultPartSize           = 16 << 20
+	// minimum part size of s3 and alioss, except the last part
+	MinPartSize            = 5 << 20
+	DefaultPartConcurrency = 4
+	// retry times of each failed part
+	DefaultPartRetries = 3
+)
+
+// first retry delay of failed part, doubled on every retry
+var partRetryDelay = time.Second
+
+// multipart upload session of one object
+type partUploader interface {
+	// number start from 1
+	UploadPart(number int, data []byte) error
+	Complete() error
+	Abort() error
+}
+
+// split reader into parts and upload them in parallel.
+// file not larger than threshold is uploaded by single with its size,
+// memory usage is about threshold + concurrency * partSize.
+func (o *options) upload(reader io.Reader, single func(r io.Reader, size int64) error, begin func() (partUploader, error)) error {
+	threshold := o.multipartThreshold
+	if threshold == 0 {
+		threshold = DefaultMultipartThreshold
+	}
+	if threshold < 0 {
+		// multipart disabled
+		return single(reader, -1)
+	}
+
+	// buffer grows with file, small file never allocates whole threshold
+	head := &bytes.Buffer{}
+	n, err := io.Copy(head, io.LimitReader(reader, threshold+1))
+	if err != nil {
+		return err
+	}
+	if n <= threshold {
+		return single(bytes.NewReader(head.Bytes()), n)
+	}
+
+	u, err := begin()
+	if err != nil {
+		return err
+	}
+	if err := o.uploadParts(io.MultiReader(head, reader), u); err != nil {
+		// NOTE: ignore abort error, keep upload error
+		u.Abort()
+		return err
+	}
+	return u.Complete()
+}
+
+func (o *options) uploadParts(reader io.Reader, u partUploader) error {
+	partSize := o.partSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	concurrency := o.partConcurrency
+	if concurrency <= 0 {
+		concurrency = DefaultPartConcurrency
+	}
+
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, concurrency)
+	errLock := sync.Mutex{}
+	var uploadErr error
+	failed := func() error {
+		errLock.Lock()
+		defer errLock.Unlock()
+		return uploadErr
+	}
+
+	for number := 1; failed() == nil; number++ {
+		sem <- struct{}{}
+		data := make([]byte, partSize)
+		n, err := io.ReadFull(reader, data)
+		if err == io.EOF {
+			<-sem
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			<-sem
+			wg.Wait()
+			return err
+		}
+		last := err == io.ErrUnexpectedEOF
+
+		wg.Add(1)
+		go func(number int, data []byte) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := o.uploadPart(u, number, data); err != nil {
+				errLock.Lock()
+				if uploadErr == nil {
+					uploadErr = err
+				}
+				errLock.Unlock()
+			}
+		}(number, data[:n])
+
+		if last {
+			break
+		}
+	}
+	wg.Wait()
+	return failed()
+}
+
+// upload part with retries
+func (o *options) uploadPart(u partUploader, number int, data []byte) error {
+	retries := o.partRetries
+	if retries == 0 {
+		retries = DefaultPartRetries
+	}
+	delay := partRetryDelay
+	err := u.UploadPart(number, data)
+	for i := 0; err != nil && i < retries; i++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = u.UploadPart(number, data)
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package storager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"testing"
+)
+
+type memPartUploader struct {
+	lock      sync.Mutex
+	parts     map[int][]byte
+	failures  map[int]int
+	completed bool
+	aborted   bool
+}
+
+func (m *memPartUploader) UploadPart(number int, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.failures[number] > 0 {
+		m.failures[number]--
+		return errors.New("part failed")
+	}
+	m.parts[number] = append([]byte{}, data...)
+	return nil
+}
+
+func (m *memPartUploader) Complete() error {
+	m.completed = true
+	return nil
+}
+
+func (m *memPartUploader) Abort() error {
+	m.aborted = true
+	return nil
+}
+
+func (m *memPartUploader) bytes() []byte {
+	numbers := []int{}
+	for n := range m.parts {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	b := []byte{}
+	for _, n := range numbers {
+		b = append(b, m.parts[n]...)
+	}
+	return b
+}
+
+func testUpload(o *options, data []byte, failures map[int]int) (single []byte, m *memPartUploader, err error) {
+	m = &memPartUploader{parts: map[int][]byte{}, failures: failures}
+	err = o.upload(bytes.NewReader(data), func(r io.Reader, size int64) error {
+		single, err = ioutil.ReadAll(r)
+		if err == nil && size >= 0 && int64(len(single)) != size {
+			return errors.New("size not match")
+		}
+		return err
+	}, func() (partUploader, error) {
+		return m, nil
+	})
+	return single, m, err
+}
+
+func TestMultipartUpload(t *testing.T) {
+	partRetryDelay = 0
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	// smaller than threshold
+	o := newOptions([]Option{WithMultipart(int64(len(data)+1), 4, 2, 0)})
+	single, m, err := testUpload(o, data, nil)
+	if err != nil || !bytes.Equal(single, data) || len(m.parts) != 0 {
+		t.Fatalf("single upload failed: %v %s", err, single)
+	}
+
+	// equal to threshold
+	o = newOptions([]Option{WithMultipart(int64(len(data)), 4, 2, 0)})
+	single, m, err = testUpload(o, data, nil)
+	if err != nil || !bytes.Equal(single, data) || len(m.parts) != 0 {
+		t.Fatalf("single upload failed: %v %s", err, single)
+	}
+
+	// split into parts, last part is short
+	o = newOptions([]Option{WithMultipart(8, 5, 3, 0)})
+	single, m, err = testUpload(o, data, map[int]int{2: 2, 7: 1})
+	if err != nil || single != nil {
+		t.Fatalf("multipart upload failed: %v", err)
+	}
+	if len(m.parts) != 8 || !m.completed || !bytes.Equal(m.bytes(), data) {
+		t.Fatalf("parts not match: %d %s", len(m.parts), m.bytes())
+	}
+
+	// size equal to multiple of part size
+	o = newOptions([]Option{WithMultipart(4, 6, 0, 0)})
+	_, m, err = testUpload(o, data, nil)
+	if err != nil || len(m.parts) != 6 || !bytes.Equal(m.bytes(), data) {
+		t.Fatalf("parts not match: %v %d", err, len(m.parts))
+	}
+
+	// retries exhausted
+	o = newOptions([]Option{WithMultipart(8, 5, 3, 1)})
+	_, m, err = testUpload(o, data, map[int]int{3: 2})
+	if err == nil || !m.aborted || m.completed {
+		t.Fatalf("want upload aborted got %v", err)
+	}
+
+	// multipart disabled
+	o = newOptions([]Option{WithMultipart(-1, 0, 0, 0)})
+	single, _, err = testUpload(o, data, nil)
+	if err != nil || !bytes.Equal(single, data) {
+		t.Fatalf("single upload failed: %v", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{"1024": 1024, "64K": 64 << 10, "16m": 16 << 20, "1GB": 1 << 30, "-1": -1}
+	for s, want := range cases {
+		n, err := ParseSize(s)
+		if err != nil || n != want {
+			t.Fatalf("%s: got %d want %d %v", s, n, want, err)
+		}
+	}
+	if _, err := ParseSize("M"); err == nil {
+		t.Fatal("want error")
+	}
+}
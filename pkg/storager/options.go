@@ -0,0 +1,121 @@
+package storager
+
+import "time"
+
+// DefaultSignedURLExpiry expiry of signed url if not set
+const DefaultSignedURLExpiry = time.Hour
+
+// Option extra options of remote storager, options not supported by storager are ignored
+type Option func(*options)
+
+type options struct {
+	region       string
+	pathStyle    bool
+	acl          string
+	storageClass string
+	// public url expiry of private bucket, 0 for public bucket
+	signedURLExpiry time.Duration
+	// multipart upload, 0 to use default, negative threshold to disable multipart
+	multipartThreshold int64
+	partSize           int64
+	partConcurrency    int
+	partRetries        int
+	// credentials when access key not set or temporary
+	profile        string
+	securityToken  string
+	ramRole        string
+	credentialsURL string
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// region of bucket, s3 only
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// use path-style addressing instead of virtual-hosted–style, s3 only
+func WithPathStyle(pathStyle bool) Option {
+	return func(o *options) {
+		o.pathStyle = pathStyle
+	}
+}
+
+// canned ACL of saved objects
+func WithACL(acl string) Option {
+	return func(o *options) {
+		o.acl = acl
+	}
+}
+
+// storage class of saved objects, access tier for azure, file type for qiniu
+func WithStorageClass(storageClass string) Option {
+	return func(o *options) {
+		o.storageClass = storageClass
+	}
+}
+
+// private bucket, PublicURL return time-limited signed url, 0 to use DefaultSignedURLExpiry
+func WithSignedURL(expiry time.Duration) Option {
+	return func(o *options) {
+		if expiry <= 0 {
+			expiry = DefaultSignedURLExpiry
+		}
+		o.signedURLExpiry = expiry
+	}
+}
+
+// upload file larger than threshold in parts, s3 alioss qiniu only.
+// zero values use defaults, negative threshold to disable, negative retries to not retry failed parts
+func WithMultipart(threshold, partSize int64, concurrency, retries int) Option {
+	return func(o *options) {
+		o.multipartThreshold = threshold
+		o.partSize = partSize
+		o.partConcurrency = concurrency
+		o.partRetries = retries
+	}
+}
+
+// shared config profile of AWS default credential chain, s3 only
+func WithProfile(profile string) Option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// STS security token of temporary access key, s3 and alioss only
+func WithSecurityToken(token string) Option {
+	return func(o *options) {
+		o.securityToken = token
+	}
+}
+
+// ECS RAM role to get auto refreshed STS credentials from instance metadata, alioss only
+func WithRAMRole(role string) Option {
+	return func(o *options) {
+		o.ramRole = role
+	}
+}
+
+// url to get auto refreshed STS credentials, alioss only
+func WithCredentialsURL(u string) Option {
+	return func(o *options) {
+		o.credentialsURL = u
+	}
+}
+
+// signed url expiry, use DefaultSignedURLExpiry if not set
+func (o *options) expiry() time.Duration {
+	if o.signedURLExpiry <= 0 {
+		return DefaultSignedURLExpiry
+	}
+	return o.signedURLExpiry
+}
@@ -0,0 +1,28 @@
+package storager
+
+import (
+	"path"
+
+	"github.com/iineva/ipa-server/pkg/storager/helper"
+)
+
+// ProxyPath server route to download files from storager which can not be accessed by public
+const ProxyPath = "/storage/"
+
+// ProxyURL url to download file over server proxy route
+func ProxyURL(publicURL, name string) (string, error) {
+	return helper.UrlJoin(publicURL, path.Join(ProxyPath, name))
+}
+
+// Proxied storager download files over server proxy route
+type Proxied interface {
+	// Proxied true if PublicURL returns ProxyURL
+	Proxied() bool
+}
+
+// UseProxy true if files of store must be downloaded over server proxy route,
+// storagers with public or signed url never need proxy route
+func UseProxy(store Storager) bool {
+	p, ok := store.(Proxied)
+	return ok && p.Proxied()
+}
@@ -1,11 +1,18 @@
 package storager
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/qiniu/go-sdk/v7/auth"
 	"github.com/qiniu/go-sdk/v7/auth/qbox"
@@ -21,17 +28,28 @@ type qiniuStorager struct {
 	secretKey string
 	domain    string
 	config    *storage.Config
+	// 0: standard 1: infrequent access 2: archive 3: deep archive
+	fileType int
+	// public url expiry of private bucket
+	signedURLExpiry time.Duration
+	options         *options
 }
 
 var _ Storager = (*qiniuStorager)(nil)
 
 var (
 	ErrQiniuZoneCodeNotFound = errors.New("qiniu zone code not found")
+	ErrQiniuFileTypeInvalid  = errors.New("qiniu file type invalid")
+	ErrQiniuDomainRequired   = errors.New("qiniu domain required, set public url to domain bound to bucket")
 )
 
 // zone option: huadong:z0 huabei:z1 huanan:z2 northAmerica:na0 singapore:as0 fogCnEast1:fog-cn-east-1
-// domain required: https://file.example.com
-func NewQiniuStorager(zone, accessKey, secretKey, bucket, domain string) (Storager, error) {
+// domain required: https://file.example.com, private bucket also download from it
+// storage class option: file type of saved objects, 0 1 2 3
+func NewQiniuStorager(zone, accessKey, secretKey, bucket, domain string, opts ...Option) (Storager, error) {
+	if domain == "" {
+		return nil, ErrQiniuDomainRequired
+	}
 	config := &storage.Config{
 		UseHTTPS:      true,
 		UseCdnDomains: false,
@@ -45,12 +63,25 @@ func NewQiniuStorager(zone, accessKey, secretKey, bucket, domain string) (Storag
 		config.Zone = &z
 	}
 
+	o := newOptions(opts)
+	fileType := 0
+	if o.storageClass != "" {
+		t, err := strconv.Atoi(o.storageClass)
+		if err != nil {
+			return nil, ErrQiniuFileTypeInvalid
+		}
+		fileType = t
+	}
+
 	return &qiniuStorager{
-		bucket:    bucket,
-		accessKey: accessKey,
-		secretKey: secretKey,
-		config:    config,
-		domain:    domain,
+		bucket:          bucket,
+		accessKey:       accessKey,
+		secretKey:       secretKey,
+		config:          config,
+		domain:          domain,
+		fileType:        fileType,
+		signedURLExpiry: o.signedURLExpiry,
+		options:         o,
 	}, nil
 }
 
@@ -60,7 +91,8 @@ func (q *qiniuStorager) newMac() *auth.Credentials {
 
 func (q *qiniuStorager) newUploadToken(keyToOverwrite string) string {
 	putPolicy := storage.PutPolicy{
-		Scope: fmt.Sprintf("%s:%s", q.bucket, keyToOverwrite),
+		Scope:    fmt.Sprintf("%s:%s", q.bucket, keyToOverwrite),
+		FileType: q.fileType,
 	}
 	return putPolicy.UploadToken(q.newMac())
 }
@@ -69,12 +101,11 @@ func (q *qiniuStorager) newBucketManager() *storage.BucketManager {
 	return storage.NewBucketManager(q.newMac(), q.config)
 }
 
-func (q *qiniuStorager) upload(name string, reader io.Reader) (*storage.PutRet, error) {
+func (q *qiniuStorager) upload(name string, reader io.Reader, size int64) (*storage.PutRet, error) {
 	// use FormUploader to ensure that the front-end progress is consistent with the back-end progress
 	uploader := storage.NewFormUploader(q.config)
 	ret := &storage.PutRet{}
 	putExtra := storage.PutExtra{}
-	size := int64(-1)
 	err := uploader.Put(context.Background(), ret, q.newUploadToken(name), name, reader, size, &putExtra)
 	if err != nil {
 		return nil, err
@@ -82,6 +113,64 @@ func (q *qiniuStorager) upload(name string, reader io.Reader) (*storage.PutRet,
 	return ret, nil
 }
 
+// resumable upload v2 session
+type qiniuPartUploader struct {
+	uploader *storage.ResumeUploaderV2
+	token    string
+	upHost   string
+	bucket   string
+	name     string
+	uploadID string
+	lock     sync.Mutex
+	parts    []storage.UploadPartInfo
+}
+
+func (q *qiniuStorager) beginUpload(name string) (partUploader, error) {
+	uploader := storage.NewResumeUploaderV2(q.config)
+	upHost, err := uploader.UpHost(q.accessKey, q.bucket)
+	if err != nil {
+		return nil, err
+	}
+	u := &qiniuPartUploader{
+		uploader: uploader,
+		token:    q.newUploadToken(name),
+		upHost:   upHost,
+		bucket:   q.bucket,
+		name:     name,
+	}
+	ret := &storage.InitPartsRet{}
+	if err := uploader.InitParts(context.Background(), u.token, upHost, q.bucket, name, true, ret); err != nil {
+		return nil, err
+	}
+	u.uploadID = ret.UploadID
+	return u, nil
+}
+
+func (u *qiniuPartUploader) UploadPart(number int, data []byte) error {
+	sum := md5.Sum(data)
+	ret := &storage.UploadPartsRet{}
+	err := u.uploader.UploadParts(context.Background(), u.token, u.upHost, u.bucket, u.name, true, u.uploadID, int64(number), hex.EncodeToString(sum[:]), ret, bytes.NewReader(data), len(data))
+	if err != nil {
+		return err
+	}
+	u.lock.Lock()
+	u.parts = append(u.parts, storage.UploadPartInfo{Etag: ret.Etag, PartNumber: int64(number)})
+	u.lock.Unlock()
+	return nil
+}
+
+func (u *qiniuPartUploader) Complete() error {
+	sort.Slice(u.parts, func(i, j int) bool { return u.parts[i].PartNumber < u.parts[j].PartNumber })
+	return u.uploader.CompleteParts(context.Background(), u.token, u.upHost, &storage.PutRet{}, u.bucket, u.name, true, u.uploadID, &storage.RputV2Extra{
+		Progresses: u.parts,
+	})
+}
+
+func (u *qiniuPartUploader) Abort() error {
+	// NOTE: SDK not support abort, uncompleted parts expire automatically
+	return nil
+}
+
 func (q *qiniuStorager) delete(name string) error {
 	return q.newBucketManager().Delete(q.bucket, name)
 }
@@ -91,8 +180,12 @@ func (q *qiniuStorager) copy(src string, dest string) error {
 }
 
 func (q *qiniuStorager) Save(name string, reader io.Reader) error {
-	_, err := q.upload(name, reader)
-	return err
+	return q.options.upload(reader, func(r io.Reader, size int64) error {
+		_, err := q.upload(name, r, size)
+		return err
+	}, func() (partUploader, error) {
+		return q.beginUpload(name)
+	})
 }
 
 func (q *qiniuStorager) OpenMetadata(name string) (io.ReadCloser, error) {
@@ -105,7 +198,10 @@ func (q *qiniuStorager) OpenMetadata(name string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
-	u := storage.MakePublicURL(q.domain, targetName)
+	u, err := q.PublicURL("", targetName)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := http.Get(u)
 	if err != nil {
 		return nil, err
@@ -123,6 +219,30 @@ func (q *qiniuStorager) Move(src, dest string) error {
 	return q.newBucketManager().Move(q.bucket, src, q.bucket, dest, true)
 }
 
+func (q *qiniuStorager) List(prefix string) ([]string, error) {
+	names := []string{}
+	marker := ""
+	m := q.newBucketManager()
+	for {
+		entries, _, next, hasNext, err := m.ListFiles(q.bucket, prefix, "", marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			names = append(names, e.Key)
+		}
+		if !hasNext {
+			return names, nil
+		}
+		marker = next
+	}
+}
+
 func (q *qiniuStorager) PublicURL(_, name string) (string, error) {
+	if q.signedURLExpiry > 0 {
+		// private download token
+		deadline := time.Now().Add(q.signedURLExpiry).Unix()
+		return storage.MakePrivateURL(q.newMac(), q.domain, name, deadline), nil
+	}
 	return helper.UrlJoin(q.domain, name)
 }
@@ -1,16 +1,20 @@
 package storager
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"io/ioutil"
 	"net/url"
+	"sort"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/iineva/ipa-server/pkg/storager/helper"
 )
 
@@ -21,29 +25,43 @@ type s3Storager struct {
 	bucket   string
 	domain   string
 	client   *s3.Client
+	options  *options
 }
 
-func NewS3Storager(endpoint, ak, sk, bucket, domain string) (Storager, error) {
+// endpoint: empty to use AWS endpoint of region
+// ak: empty to use AWS default credential chain
+func NewS3Storager(endpoint, ak, sk, bucket, domain string, opts ...Option) (Storager, error) {
+	o := newOptions(opts)
 
-	u, err := url.Parse(endpoint)
-	if err != nil {
-		return nil, err
+	loadOpts := []func(*config.LoadOptions) error{}
+	if ak != "" {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(ak, sk, o.securityToken)))
 	}
-	if u.Scheme == "" {
-		u.Scheme = "https"
+	// without access key use default credential chain: env, shared profile, web identity, container and instance metadata
+	if o.profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(o.profile))
 	}
+	if o.region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(o.region))
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" {
+			u.Scheme = "https"
+		}
 
-	customResolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
-		return aws.Endpoint{
-			URL: u.String(),
-		}, nil
-	})
+		customResolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+			return aws.Endpoint{
+				URL: u.String(),
+			}, nil
+		})
+		loadOpts = append(loadOpts, config.WithEndpointResolver(customResolver))
+	}
 
-	cfg, err := config.LoadDefaultConfig(
-		context.Background(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(ak, sk, "")),
-		config.WithEndpointResolver(customResolver),
-	)
+	cfg, err := config.LoadDefaultConfig(context.Background(), loadOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,19 +72,90 @@ func NewS3Storager(endpoint, ak, sk, bucket, domain string) (Storager, error) {
 		sk:       sk,
 		bucket:   bucket,
 		domain:   domain,
-		client:   s3.NewFromConfig(cfg),
+		client: s3.NewFromConfig(cfg, func(so *s3.Options) {
+			so.UsePathStyle = o.pathStyle
+		}),
+		options: o,
 	}, nil
 }
 
 func (s *s3Storager) Save(name string, reader io.Reader) error {
-	r := ioutil.NopCloser(reader) // avoid oss SDK to close reader
-	_, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(name),
-		Body:   r,
+	return s.options.upload(reader, func(r io.Reader, size int64) error {
+		input := &s3.PutObjectInput{
+			Bucket:       aws.String(s.bucket),
+			Key:          aws.String(name),
+			Body:         ioutil.NopCloser(r), // avoid oss SDK to close reader
+			ACL:          types.ObjectCannedACL(s.options.acl),
+			StorageClass: types.StorageClass(s.options.storageClass),
+		}
+		if size >= 0 {
+			// buffered small file, seekable body can be retried by SDK
+			input.Body = r
+			input.ContentLength = size
+		}
+		_, err := s.client.PutObject(context.Background(), input, s3.WithAPIOptions(
+			v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware,
+		))
+		return err
+	}, func() (partUploader, error) {
+		out, err := s.client.CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+			Bucket:       aws.String(s.bucket),
+			Key:          aws.String(name),
+			ACL:          types.ObjectCannedACL(s.options.acl),
+			StorageClass: types.StorageClass(s.options.storageClass),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s3PartUploader{s: s, name: name, uploadID: out.UploadId}, nil
+	})
+}
+
+type s3PartUploader struct {
+	s        *s3Storager
+	name     string
+	uploadID *string
+	lock     sync.Mutex
+	parts    []types.CompletedPart
+}
+
+func (u *s3PartUploader) UploadPart(number int, data []byte) error {
+	out, err := u.s.client.UploadPart(context.Background(), &s3.UploadPartInput{
+		Bucket:        aws.String(u.s.bucket),
+		Key:           aws.String(u.name),
+		UploadId:      u.uploadID,
+		PartNumber:    int32(number),
+		Body:          bytes.NewReader(data),
+		ContentLength: int64(len(data)),
 	}, s3.WithAPIOptions(
 		v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware,
 	))
+	if err != nil {
+		return err
+	}
+	u.lock.Lock()
+	u.parts = append(u.parts, types.CompletedPart{ETag: out.ETag, PartNumber: int32(number)})
+	u.lock.Unlock()
+	return nil
+}
+
+func (u *s3PartUploader) Complete() error {
+	sort.Slice(u.parts, func(i, j int) bool { return u.parts[i].PartNumber < u.parts[j].PartNumber })
+	_, err := u.s.client.CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.s.bucket),
+		Key:             aws.String(u.name),
+		UploadId:        u.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: u.parts},
+	})
+	return err
+}
+
+func (u *s3PartUploader) Abort() error {
+	_, err := u.s.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(u.s.bucket),
+		Key:      aws.String(u.name),
+		UploadId: u.uploadID,
+	})
 	return err
 }
 
@@ -75,7 +164,11 @@ func (s *s3Storager) OpenMetadata(name string) (io.ReadCloser, error) {
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(name),
 	})
-	return out.Body, err
+	if err != nil {
+		// output is nil on error
+		return nil, err
+	}
+	return out.Body, nil
 }
 
 func (s *s3Storager) Delete(name string) error {
@@ -88,9 +181,11 @@ func (s *s3Storager) Delete(name string) error {
 
 func (s *s3Storager) Move(src, dest string) error {
 	_, err := s.client.CopyObject(context.Background(), &s3.CopyObjectInput{
-		Bucket:     aws.String(s.bucket),
-		CopySource: aws.String(s.bucket + "/" + src),
-		Key:        aws.String(dest),
+		Bucket:       aws.String(s.bucket),
+		CopySource:   aws.String(s.bucket + "/" + src),
+		Key:          aws.String(dest),
+		ACL:          types.ObjectCannedACL(s.options.acl),
+		StorageClass: types.StorageClass(s.options.storageClass),
 	})
 	if err != nil {
 		return err
@@ -98,6 +193,34 @@ func (s *s3Storager) Move(src, dest string) error {
 	return s.Delete(src)
 }
 
+func (s *s3Storager) List(prefix string) ([]string, error) {
+	names := []string{}
+	p := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range out.Contents {
+			names = append(names, aws.ToString(obj.Key))
+		}
+	}
+	return names, nil
+}
+
 func (s *s3Storager) PublicURL(publicURL, name string) (string, error) {
+	if s.options.signedURLExpiry > 0 {
+		req, err := s3.NewPresignClient(s.client).PresignGetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(name),
+		}, s3.WithPresignExpires(s.options.signedURLExpiry))
+		if err != nil {
+			return "", err
+		}
+		return req.URL, nil
+	}
 	return helper.UrlJoin(s.domain, name)
 }
@@ -0,0 +1,187 @@
+package storager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/sftpfs"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/iineva/ipa-server/pkg/storager/helper"
+)
+
+type sftpStorager struct {
+	lock   sync.Mutex
+	addr   string
+	config *ssh.ClientConfig
+	root   string
+	domain string
+	client *sftp.Client
+}
+
+var _ Storager = (*sftpStorager)(nil)
+
+var (
+	ErrSFTPHostKeyRequired = errors.New("sftp known_hosts or host key fingerprint required, or set insecure to skip host key verification")
+	ErrSFTPHostKeyMismatch = errors.New("sftp host key fingerprint not match")
+)
+
+const (
+	sftpDefaultPort = "22"
+	sftpDialTimeout = 10 * time.Second
+)
+
+// addr: HOST[:PORT]
+// credential: password, or private key file path
+// root: directory to save files on server
+// knownHosts: known_hosts file to verify host key
+// fingerprint: SHA256 fingerprint of host key, eg: SHA256:BASE64, used if knownHosts is empty
+// insecure: skip host key verification if both knownHosts and fingerprint are empty
+// domain: public url of root, empty to download files over server proxy route
+func NewSFTPStorager(addr, user, credential, root, knownHosts, fingerprint string, insecure bool, domain string) (Storager, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, sftpDefaultPort)
+	}
+
+	auth := []ssh.AuthMethod{}
+	if key, err := ioutil.ReadFile(credential); err == nil {
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else {
+		auth = append(auth, ssh.Password(credential))
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(knownHosts, fingerprint, insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sftpStorager{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         sftpDialTimeout,
+		},
+		root:   root,
+		domain: domain,
+	}
+	// check connection
+	if _, err := s.storager(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func sftpHostKeyCallback(knownHosts, fingerprint string, insecure bool) (ssh.HostKeyCallback, error) {
+	switch {
+	case knownHosts != "":
+		return knownhosts.New(knownHosts)
+	case fingerprint != "":
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != fingerprint {
+				return fmt.Errorf("%w: %s %s", ErrSFTPHostKeyMismatch, hostname, got)
+			}
+			return nil
+		}, nil
+	case insecure:
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return nil, ErrSFTPHostKeyRequired
+}
+
+// get afero storager over current connection, reconnect if connection lost
+func (s *sftpStorager) storager() (Storager, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.client == nil {
+		conn, err := ssh.Dial("tcp", s.addr, s.config)
+		if err != nil {
+			return nil, err
+		}
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		s.client = client
+		go func() {
+			_ = conn.Wait()
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if s.client == client {
+				s.client = nil
+			}
+		}()
+	}
+
+	var fs afero.Fs = sftpfs.New(s.client)
+	if s.root != "" {
+		fs = afero.NewBasePathFs(fs, s.root)
+	}
+	return NewAferoStorager(fs), nil
+}
+
+func (s *sftpStorager) Save(name string, reader io.Reader) error {
+	store, err := s.storager()
+	if err != nil {
+		return err
+	}
+	return store.Save(name, reader)
+}
+
+func (s *sftpStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	store, err := s.storager()
+	if err != nil {
+		return nil, err
+	}
+	return store.OpenMetadata(name)
+}
+
+func (s *sftpStorager) Delete(name string) error {
+	store, err := s.storager()
+	if err != nil {
+		return err
+	}
+	return store.Delete(name)
+}
+
+func (s *sftpStorager) Move(src, dest string) error {
+	store, err := s.storager()
+	if err != nil {
+		return err
+	}
+	return store.Move(src, dest)
+}
+
+func (s *sftpStorager) List(prefix string) ([]string, error) {
+	store, err := s.storager()
+	if err != nil {
+		return nil, err
+	}
+	return store.List(prefix)
+}
+
+func (s *sftpStorager) PublicURL(publicURL, name string) (string, error) {
+	if s.domain != "" {
+		return helper.UrlJoin(s.domain, name)
+	}
+	return ProxyURL(publicURL, name)
+}
+
+func (s *sftpStorager) Proxied() bool {
+	return s.domain == ""
+}
@@ -0,0 +1,51 @@
+package storager
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// run SFTP server first:
+// docker run -p 2222:22 atmoz/sftp foo:pass:::upload
+func TestSFTP(t *testing.T) {
+
+	addr := "127.0.0.1:2222"
+	user := "foo"
+	credential := "pass"
+	root := "upload"
+	knownHosts := ""
+	domain := ""
+
+	s, err := NewSFTPStorager(addr, user, credential, root, knownHosts, "", true, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorager(s, t)
+}
+
+func TestSFTPHostKey(t *testing.T) {
+	if _, err := NewSFTPStorager("127.0.0.1:2222", "foo", "pass", "upload", "", "", false, ""); err != ErrSFTPHostKeyRequired {
+		t.Fatalf("want ErrSFTPHostKeyRequired got %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := signer.PublicKey()
+	cb, err := sftpHostKeyCallback("", ssh.FingerprintSHA256(key), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cb("nas.example.com:22", nil, key); err != nil {
+		t.Fatal(err)
+	}
+	cb, _ = sftpHostKeyCallback("", "SHA256:other", false)
+	if err := cb("nas.example.com:22", nil, key); !errors.Is(err, ErrSFTPHostKeyMismatch) {
+		t.Fatalf("want ErrSFTPHostKeyMismatch got %v", err)
+	}
+}
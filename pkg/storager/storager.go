@@ -10,4 +10,6 @@ type Storager interface {
 	Delete(name string) error
 	Move(src, dest string) error
 	PublicURL(publicURL, name string) (string, error)
+	// List names of files start with prefix, empty prefix to list all files
+	List(prefix string) ([]string, error)
 }
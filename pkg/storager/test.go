@@ -31,8 +31,25 @@ func testStorager(s Storager, t *testing.T) {
 		reader.Close()
 		t.Fatal(err)
 	}
+	// list file
+	names, err := s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsName(names, name) {
+		t.Fatalf("%s not listed: %v", name, names)
+	}
 	// delete file
 	if err := s.Delete(name); err != nil {
 		t.Fatal(err)
 	}
 }
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package storager
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/iineva/ipa-server/pkg/storager/helper"
+)
+
+type webdavStorager struct {
+	endpoint *url.URL
+	user     string
+	pass     string
+	domain   string
+	client   *http.Client
+}
+
+var _ Storager = (*webdavStorager)(nil)
+
+// endpoint: root collection url, https://nas.example.com/dav/ipa
+// domain: public url of root collection, empty to download files over server proxy route
+func NewWebDAVStorager(endpoint, user, pass, domain string) (Storager, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		u, err = url.Parse("https://" + endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &webdavStorager{
+		endpoint: u,
+		user:     user,
+		pass:     pass,
+		domain:   domain,
+		client:   &http.Client{},
+	}, nil
+}
+
+func (w *webdavStorager) url(name string) string {
+	u := *w.endpoint
+	u.Path = u.Path + "/" + strings.TrimPrefix(path.Clean("/"+name), "/")
+	// keep trailing slash of collection
+	if strings.HasSuffix(name, "/") && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+func (w *webdavStorager) do(method, name string, header map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, w.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if w.user != "" {
+		req.SetBasicAuth(w.user, w.pass)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return w.client.Do(req)
+}
+
+// do request and check response status
+func (w *webdavStorager) request(method, name string, header map[string]string, body io.Reader, okStatus ...int) (*http.Response, error) {
+	resp, err := w.do(method, name, header, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range okStatus {
+		if resp.StatusCode == s {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, fmt.Errorf("webdav %s %s: %s", method, name, resp.Status)
+}
+
+// create parent collections of name
+func (w *webdavStorager) mkdirAll(name string) error {
+	dir := path.Dir(path.Clean("/" + name))
+	if dir == "/" {
+		return nil
+	}
+	// fast path: collection already exists
+	if resp, err := w.do("PROPFIND", dir+"/", map[string]string{"Depth": "0"}, nil); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusMultiStatus {
+			return nil
+		}
+	}
+	if err := w.mkdirAll(dir); err != nil {
+		return err
+	}
+	// 405: collection already exists
+	resp, err := w.request("MKCOL", dir+"/", nil, nil, http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (w *webdavStorager) Save(name string, reader io.Reader) error {
+	if err := w.mkdirAll(name); err != nil {
+		return err
+	}
+	// avoid http client to close reader
+	resp, err := w.request(http.MethodPut, name, nil, ioutil.NopCloser(reader), http.StatusCreated, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (w *webdavStorager) OpenMetadata(name string) (io.ReadCloser, error) {
+	resp, err := w.request(http.MethodGet, name, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (w *webdavStorager) Delete(name string) error {
+	resp, err := w.request(http.MethodDelete, name, nil, nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// auto delete empty dir
+	err = w.deleteEmptyDir(path.Dir(path.Clean("/" + name)))
+	if err != nil {
+		// NOTE: ignore error
+	}
+	return nil
+}
+
+func (w *webdavStorager) deleteEmptyDir(dir string) error {
+	if dir == "/" {
+		return nil
+	}
+
+	resp, err := w.request("PROPFIND", dir+"/", map[string]string{"Depth": "1"}, nil, http.StatusMultiStatus)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ms := struct {
+		Responses []struct{} `xml:"response"`
+	}{}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return err
+	}
+	// only collection itself
+	if len(ms.Responses) > 1 {
+		return nil
+	}
+
+	resp, err = w.request(http.MethodDelete, dir+"/", nil, nil, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return w.deleteEmptyDir(path.Dir(dir))
+}
+
+func (w *webdavStorager) Move(src, dest string) error {
+	if err := w.mkdirAll(dest); err != nil {
+		return err
+	}
+	resp, err := w.request("MOVE", src, map[string]string{
+		"Destination": w.url(dest),
+		"Overwrite":   "T",
+	}, nil, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (w *webdavStorager) List(prefix string) ([]string, error) {
+	// walk from collection of prefix
+	dir := path.Dir(path.Clean("/" + prefix))
+	if strings.HasSuffix(prefix, "/") {
+		dir = path.Clean("/" + prefix)
+	}
+	names := []string{}
+	if err := w.walk(dir, prefix, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// list files of collection dir recursively, Depth: infinity is disabled by most servers
+func (w *webdavStorager) walk(dir, prefix string, names *[]string) error {
+	resp, err := w.do("PROPFIND", strings.TrimSuffix(dir, "/")+"/", map[string]string{"Depth": "1"}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return fmt.Errorf("webdav PROPFIND %s: %s", dir, resp.Status)
+	}
+	ms := struct {
+		Responses []struct {
+			Href       string    `xml:"href"`
+			Collection *struct{} `xml:"propstat>prop>resourcetype>collection"`
+		} `xml:"response"`
+	}{}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return err
+	}
+
+	root := strings.TrimSuffix(w.endpoint.Path, "/")
+	for _, r := range ms.Responses {
+		u, err := url.Parse(r.Href)
+		if err != nil {
+			return err
+		}
+		// href is absolute path of server
+		name := strings.TrimPrefix(path.Clean(u.Path), root)
+		if path.Clean("/"+name) == path.Clean(dir) {
+			// collection itself
+			continue
+		}
+		name = strings.TrimPrefix(name, "/")
+		if r.Collection != nil {
+			// skip collections not match prefix
+			if strings.HasPrefix(name+"/", prefix) || strings.HasPrefix(prefix, name+"/") {
+				if err := w.walk("/"+name, prefix, names); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(name, prefix) {
+			*names = append(*names, name)
+		}
+	}
+	return nil
+}
+
+func (w *webdavStorager) PublicURL(publicURL, name string) (string, error) {
+	if w.domain != "" {
+		return helper.UrlJoin(w.domain, name)
+	}
+	return ProxyURL(publicURL, name)
+}
+
+func (w *webdavStorager) Proxied() bool {
+	return w.domain == ""
+}
@@ -0,0 +1,63 @@
+package storager
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+func TestWebDAV(t *testing.T) {
+	fs := webdav.NewMemFS()
+	srv := httptest.NewServer(&webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	})
+	defer srv.Close()
+
+	w, err := NewWebDAVStorager(srv.URL, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorager(w, t)
+
+	// create parent dir on save, delete empty dir on delete
+	f, err := os.Open("../../public/img/default.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := w.Save("a/b/test.png", f); err != nil {
+		t.Fatal(err)
+	}
+	names, err := w.List("a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "a/b/test.png" {
+		t.Fatalf("list not match: %v", names)
+	}
+	if err := w.Move("a/b/test.png", "c/test.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(context.Background(), "/c/test.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Delete("c/test.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(context.Background(), "/c"); !os.IsNotExist(err) {
+		t.Fatalf("empty dir not deleted: %v", err)
+	}
+
+	u, err := w.PublicURL("https://example.com", "a/test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://example.com/storage/a/test.png" {
+		t.Fatalf("proxy url not match: %s", u)
+	}
+}
@@ -29,6 +29,8 @@ type websocketFile struct {
 	rand   *rand.Rand
 	offset int64
 	size   int64
+	// params of name response
+	params map[string]interface{}
 }
 
 type CommandType int32
@@ -51,7 +53,10 @@ type WebsocketFile interface {
 	io.Reader
 	Size() (int64, error)
 	Name() (string, error)
+	// string param sent by client with name, eg: notes, empty before Name called
+	Param(key string) string
 	Done(p map[string]interface{}) error
+	Close() error
 }
 
 func NewWebsocketFile(w http.ResponseWriter, r *http.Request) (WebsocketFile, error) {
@@ -156,6 +161,7 @@ func (w *websocketFile) Name() (n string, err error) {
 		return "", err
 	}
 
+	w.params = resp.Param
 	data, ok := resp.Param["name"]
 	if !ok {
 		return "", nil
@@ -168,6 +174,11 @@ func (w *websocketFile) Name() (n string, err error) {
 	return name, nil
 }
 
+func (w *websocketFile) Param(key string) string {
+	v, _ := w.params[key].(string)
+	return v
+}
+
 func (w *websocketFile) Done(p map[string]interface{}) error {
 	err := w.send(CommandTypeDone, p)
 	if err != nil {
@@ -176,6 +187,10 @@ func (w *websocketFile) Done(p map[string]interface{}) error {
 	return nil
 }
 
+func (w *websocketFile) Close() error {
+	return w.conn.Close()
+}
+
 func (w *websocketFile) send(typ CommandType, p map[string]interface{}) error {
 	requestId := fmt.Sprintf("%d", rand.Uint64())
 	err := w.conn.WriteJSON(&Command{
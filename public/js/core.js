@@ -31,7 +31,8 @@
             });
         }
 
-        function newUpload(file, _onProgress) {
+        // notes: optional release notes in Markdown
+        function newUpload(file, _onProgress, notes) {
             var onProgress = function(m) {
                 _onProgress && _onProgress({
                     loaded: m.loaded,
@@ -108,6 +109,7 @@
                   case CommandTypeName: {
                     sendRequest(msg.command, msg.requestId, {
                         name: file.name,
+                        notes: notes || "",
                     })
                     break
                   }
@@ -196,6 +198,15 @@
                 'Delete Success!': {
                     'zh-cn': '删除成功！'
                 },
+                'Pinned': {
+                    'zh-cn': '已置顶'
+                },
+                'Locked': {
+                    'zh-cn': '已锁定'
+                },
+                'Package corrupted, checksum not match': {
+                    'zh-cn': '安装包已损坏，校验和不匹配'
+                },
             }
             const lang = (localStr[key] || key)[language().toLowerCase()]
             return lang ? lang : key
@@ -262,6 +273,10 @@
             ${row.name}
             ${icons.map(t => `<img class="icon-tag ${t}" src="/img/${t}.svg">`).join('')}
             ${row.current ? `<span class="tag">${langString('Current')}</span>` : ''}
+            ${row.pinned ? `<span class="tag">${langString('Pinned')}</span>` : ''}
+            ${row.locked ? `<span class="tag">${langString('Locked')}</span>` : ''}
+            ${(row.tracks || []).map(t => `<span class="tag">${t}</span>`).join('')}
+            ${(row.tags || []).map(t => `<span class="tag">${t}</span>`).join('')}
           </div>
           <div class="version">
             <span>${row.version}(Build ${row.build})</span>